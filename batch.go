@@ -0,0 +1,326 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchConcurrency is the number of requests the batch helpers have in flight at once, unless the requester
+// shares a Semaphore between them.
+const batchConcurrency = 5
+
+// Semaphore caps the number of requests the batch helpers have in flight at once, across every call made
+// with the requesters it was given to using WithSemaphore.
+type Semaphore chan struct{}
+
+// NewSemaphore returns a semaphore allowing n requests in flight at once.
+func NewSemaphore(n int) Semaphore {
+	return make(Semaphore, n)
+}
+
+// WithSemaphore makes the batch helpers share the semaphore instead of each allowing batchConcurrency
+// requests in flight, e.g. to respect one budget while deleting snapshots and creating volumes concurrently.
+func WithSemaphore(sem Semaphore) Option {
+	return func(c *awsClient) {
+		c.sem = sem
+	}
+}
+
+// outside calls fn without the slot held by the calling goroutine of forEachIn, e.g. while waiting rather than
+// sending requests, and takes a slot again before returning.
+func (sem Semaphore) outside(fn func() error) error {
+	<-sem
+	defer func() { sem <- struct{}{} }()
+	return fn()
+}
+
+// semaphoreOf returns the semaphore shared by the requester, or a new one for a single batch operation.
+func semaphoreOf(sr SignedRequester) Semaphore {
+	if c, ok := sr.(*awsClient); ok && c.sem != nil {
+		return c.sem
+	}
+	return NewSemaphore(batchConcurrency)
+}
+
+// failureSummary describes the errors of a batch operation, ordered by resource id.
+func failureSummary(failed map[string]error) string {
+	var reasons []string
+	for id, err := range failed {
+		reasons = append(reasons, id+": "+err.Error())
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, "; ")
+}
+
+// BatchResult is the outcome of an operation on several resources, some of which may have failed while
+// the others succeeded.
+type BatchResult struct {
+	// Succeeded are the ids of the resources the operation succeeded for.
+	Succeeded []string
+	// Failed maps the ids of the other resources to the reason they failed.
+	Failed map[string]error
+}
+
+func newBatchResult() *BatchResult {
+	return &BatchResult{Failed: make(map[string]error)}
+}
+
+// Err returns an error describing the failures, or nil if the operation succeeded for every resource.
+func (r *BatchResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d failed, %s", len(r.Failed), len(r.Failed)+len(r.Succeeded), failureSummary(r.Failed))
+}
+
+// DeleteSnapshots deletes the snapshots concurrently and returns which were deleted and why the others
+// failed. Snapshots that are already gone are considered deleted.
+func DeleteSnapshots(ctx context.Context, sr SignedRequester, ids []string) *BatchResult {
+	return deleteAll(ctx, sr, ids, "InvalidSnapshot.NotFound", func(id string) error {
+		return DeleteSnapshot(sr, id)
+	})
+}
+
+// DeleteVolumes deletes the volumes concurrently and returns which were deleted and why the others failed.
+// Volumes that are already gone are considered deleted.
+func DeleteVolumes(ctx context.Context, sr SignedRequester, ids []string) *BatchResult {
+	return deleteAll(ctx, sr, ids, "InvalidVolume.NotFound", func(id string) error {
+		return DeleteVolume(sr, id)
+	})
+}
+
+// deleteAll calls del for every id like forEach, failures with the notFound error code count as deleted.
+func deleteAll(ctx context.Context, sr SignedRequester, ids []string, notFound string, del func(string) error) *BatchResult {
+	return forEach(ctx, sr, ids, func(id string) error {
+		if err := del(id); ErrorCode(err) != notFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// forEach calls fn for every id with at most as many calls at once as the semaphore of the requester allows.
+// Ids not started yet when the context is done fail with its error.
+func forEach(ctx context.Context, sr SignedRequester, ids []string, fn func(string) error) *BatchResult {
+	return forEachIn(ctx, semaphoreOf(sr), ids, fn)
+}
+
+// forEachIn is forEach using the semaphore, for callers of sem.outside in fn.
+func forEachIn(ctx context.Context, sem Semaphore, ids []string, fn func(string) error) *BatchResult {
+	result := newBatchResult()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		acquired := false
+		select {
+		case sem <- struct{}{}:
+			acquired = true
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			if acquired {
+				<-sem
+			}
+			mu.Lock()
+			result.Failed[id] = err
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			err := fn(id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed[id] = err
+			} else {
+				result.Succeeded = append(result.Succeeded, id)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	return result
+}
+
+// CreateVolumeInAZs creates a volume according to spec in each of the availability zones concurrently, e.g.
+// for the replicas of a database, ignoring spec.AZ. A ClientToken is suffixed with the zone, since Amazon refuses
+// a token reused for another zone. The volumes created are returned keyed by zone, along with an error
+// describing the zones that failed, if any.
+func CreateVolumeInAZs(ctx context.Context, sr SignedRequester, spec VolumeSpec, azs []string) (map[string]*EbsVolume, error) {
+	vols := make(map[string]*EbsVolume, len(azs))
+	var mu sync.Mutex
+	result := forEach(ctx, sr, azs, func(az string) error {
+		zoneSpec := spec
+		zoneSpec.AZ = az
+		if spec.ClientToken != "" {
+			zoneSpec.ClientToken = spec.ClientToken + "-" + az
+		}
+		vol, err := CreateVolumeSpec(sr, zoneSpec)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		vols[az] = vol
+		mu.Unlock()
+		return nil
+	})
+	if err := result.Err(); err != nil {
+		return vols, fmt.Errorf("Could not create volumes in every zone, %s", err)
+	}
+	return vols, nil
+}
+
+// SnapshotRetryConfig is the backoff of CreateSnapshotsThrottled. Amazon limits how often a volume can be
+// snapshotted and the number of snapshots being created, which takes a lot longer to recover from than the
+// request rate limits RetryConfig is meant for.
+var SnapshotRetryConfig = RetryConfig{
+	Attempts:  6,
+	BaseDelay: 15 * time.Second,
+	MaxDelay:  2 * time.Minute,
+}
+
+// isSnapshotThrottlingError reports whether the snapshot wasn't created because of the snapshot rate limits
+// or because we were still throttled once the retries of the requester were exhausted.
+func isSnapshotThrottlingError(err error) bool {
+	switch ErrorCode(err) {
+	case "SnapshotCreationPerVolumeRateExceeded", "ResourceLimitExceeded":
+		return true
+	}
+	return IsThrottlingError(err)
+}
+
+// CreateSnapshotsThrottled snapshots the volumes with the tags, with at most as many snapshots started at once
+// as the semaphore of the requester allows. Snapshots refused because of the rate limits are tried again after
+// backing off according to SnapshotRetryConfig, without holding a slot of the semaphore meanwhile. The snapshots
+// created are returned keyed by volume id, along with an error describing the volumes that failed, if any.
+func CreateSnapshotsThrottled(ctx context.Context, sr SignedRequester, volumeIds []string, description string, tags []TagItem) (map[string]*EbsSnapshot, error) {
+	snaps := make(map[string]*EbsSnapshot, len(volumeIds))
+	clock := clockOf(sr)
+	sem := semaphoreOf(sr)
+	var mu sync.Mutex
+	result := forEachIn(ctx, sem, volumeIds, func(id string) error {
+		for attempt := 1; ; attempt++ {
+			snap, err := CreateSnapshotWithTags(sr, id, description, tags)
+			if err == nil {
+				mu.Lock()
+				snaps[id] = snap
+				mu.Unlock()
+				return nil
+			}
+			if !isSnapshotThrottlingError(err) || attempt >= SnapshotRetryConfig.Attempts {
+				return err
+			}
+			err = sem.outside(func() error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-clock.After(SnapshotRetryConfig.backoff(attempt)):
+					return nil
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err := result.Err(); err != nil {
+		return snaps, fmt.Errorf("Could not snapshot every volume, %s", err)
+	}
+	return snaps, nil
+}
+
+// DetachAllVolumes detaches every volume but the root device from the instance concurrently, e.g. before
+// terminating it. When wait is set it also waits for the volumes to become available. The error is only set
+// when the instance could not be looked up, failures to detach single volumes are reported by the result.
+func DetachAllVolumes(ctx context.Context, sr SignedRequester, instanceId string, wait bool) (*BatchResult, error) {
+	instance, err := InstanceById(sr, instanceId)
+	if err != nil {
+		return nil, err
+	}
+	return detachVolumes(ctx, sr, dataVolumeIds(instance), wait), nil
+}
+
+// dataVolumeIds returns the ids of the volumes attached to the instance, except the root device.
+func dataVolumeIds(instance *Instance) []string {
+	var ids []string
+	for _, mapping := range instance.BlockDeviceMapping.Items {
+		if mapping.Device == instance.RootDeviceName || mapping.Info.Id == "" {
+			continue
+		}
+		ids = append(ids, mapping.Info.Id)
+	}
+	return ids
+}
+
+// detachVolumes detaches the volumes like forEach, waiting for each to become available when wait is set. The
+// slots of the semaphore are only held while detaching, not while waiting.
+func detachVolumes(ctx context.Context, sr SignedRequester, ids []string, wait bool) *BatchResult {
+	sem := semaphoreOf(sr)
+	result := forEachIn(ctx, sem, ids, func(id string) error {
+		if _, err := DetachVolume(sr, id); err != nil || !wait {
+			return err
+		}
+		return sem.outside(func() error {
+			_, err := WaitForVolumeStatus(ctx, sr, id, VolumeAvailable, nil)
+			return err
+		})
+	})
+	sort.Strings(result.Succeeded)
+	return result
+}
+
+// PrepareForTermination snapshots, if requested, and detaches every volume but the root device of the instance,
+// e.g. when a spot instance is about to be interrupted; the deadline of the context should match the notice.
+// Snapshots capture the volumes when they are started, so only the detachments are waited for. Volumes are
+// detached even if their snapshot failed, the error describes every failure.
+func PrepareForTermination(ctx context.Context, sr SignedRequester, instanceId string, snapshot bool) (snapshots []string, detached []string, err error) {
+	instance, err := InstanceById(sr, instanceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := dataVolumeIds(instance)
+
+	failed := make(map[string]error)
+	if snapshot {
+		var mu sync.Mutex
+		result := forEach(ctx, sr, ids, func(id string) error {
+			snap, err := CreateSnapshot(sr, id, "Before terminating "+instanceId)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			snapshots = append(snapshots, snap.Id)
+			mu.Unlock()
+			return nil
+		})
+		for id, err := range result.Failed {
+			failed[id] = fmt.Errorf("Could not snapshot: %s", err)
+		}
+		sort.Strings(snapshots)
+	}
+
+	result := detachVolumes(ctx, sr, ids, true)
+	for id, err := range result.Failed {
+		if prev, ok := failed[id]; ok {
+			err = fmt.Errorf("%s, could not detach: %s", prev, err)
+		}
+		failed[id] = err
+	}
+	if len(failed) > 0 {
+		err = fmt.Errorf("Could not prepare %s for termination, %s", instanceId, failureSummary(failed))
+	}
+	return snapshots, result.Succeeded, err
+}
@@ -0,0 +1,545 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeleteSnapshots(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if a := "DeleteSnapshot"; q.Get("Action") != a {
+			t.Errorf("Expected Action to be %s", a)
+		}
+		switch id := q.Get("SnapshotId"); id {
+		case "snap-gone":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>InvalidSnapshot.NotFound</Code><Message>The snapshot '%s' does not exist.</Message></Error></Errors><RequestID>1b3e4a3f-8e0c-4b0e-9c8a-EXAMPLE</RequestID></Response>`, id)
+		case "snap-ami":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>InvalidSnapshot.InUse</Code><Message>The snapshot %s is currently in use by ami-1a2b3c4d</Message></Error></Errors><RequestID>1b3e4a3f-8e0c-4b0e-9c8a-EXAMPLE</RequestID></Response>`, id)
+		default:
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DeleteSnapshotResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <return>true</return>
+</DeleteSnapshotResponse>`)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	result := DeleteSnapshots(context.Background(), sr, []string{"snap-1db38de7", "snap-gone", "snap-ami"})
+	deleted, failed := result.Succeeded, result.Failed
+	sort.Strings(deleted)
+	if len(deleted) != 2 || deleted[0] != "snap-1db38de7" || deleted[1] != "snap-gone" {
+		t.Error("Expected existing and already deleted snapshot to be deleted, got", deleted)
+	}
+	if len(failed) != 1 || ErrorCode(failed["snap-ami"]) != "InvalidSnapshot.InUse" {
+		t.Error("Expected snapshot in use to fail, got", failed)
+	}
+	if err := result.Err(); err == nil || !strings.Contains(err.Error(), "1 of 3 failed") {
+		t.Error("Expected the failure to be reported, got", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := DeleteSnapshots(ctx, sr, []string{"snap-1db38de7"}); len(result.Succeeded) != 0 || result.Failed["snap-1db38de7"] != context.Canceled {
+		t.Error("Expected cancelled context to prevent deletion, got", result.Succeeded, result.Failed)
+	}
+}
+
+func TestDetachAllVolumes(t *testing.T) {
+	var mu sync.Mutex
+	var detaching []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeInstances":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <rootDeviceName>/dev/sda1</rootDeviceName>
+                    <blockDeviceMapping>
+                        <item><deviceName>/dev/sda1</deviceName><ebs><volumeId>vol-1a2b3c4d</volumeId></ebs></item>
+                        <item><deviceName>/dev/sdf</deviceName><ebs><volumeId>vol-72d8f579</volumeId></ebs></item>
+                        <item><deviceName>/dev/sdg</deviceName><ebs><volumeId>vol-842b078f</volumeId></ebs></item>
+                    </blockDeviceMapping>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`)
+		case "DetachVolume":
+			id := q.Get("VolumeId")
+			mu.Lock()
+			detaching = append(detaching, id)
+			mu.Unlock()
+			if id == "vol-842b078f" {
+				w.WriteHeader(400)
+				fmt.Fprint(w, `<Response><Errors><Error><Code>IncorrectState</Code><Message>Volume is busy</Message></Error></Errors></Response>`)
+				return
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DetachVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeId>vol-72d8f579</volumeId>
+    <status>detaching</status>
+</DetachVolumeResponse>`)
+		case "DescribeVolumes":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>%s</volumeId>
+            <status>available</status>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, q.Get("VolumeId.1"))
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+
+	result, err := DetachAllVolumes(context.Background(), sr, "i-7ae3b239", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err() == nil || result.Failed["vol-842b078f"] == nil {
+		t.Error("Expected the failure of vol-842b078f to be reported, got", result.Failed)
+	}
+	detached := result.Succeeded
+	sort.Strings(detaching)
+	if fmt.Sprint(detaching) != "[vol-72d8f579 vol-842b078f]" {
+		t.Error("Expected every volume but the root device to be detached, got", detaching)
+	}
+	if len(detached) != 1 || detached[0] != "vol-72d8f579" {
+		t.Error("Expected vol-72d8f579 to be detached, got", detached)
+	}
+}
+
+func TestPrepareForTermination(t *testing.T) {
+	var mu sync.Mutex
+	var detaching []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeInstances":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <rootDeviceName>/dev/sda1</rootDeviceName>
+                    <blockDeviceMapping>
+                        <item><deviceName>/dev/sda1</deviceName><ebs><volumeId>vol-1a2b3c4d</volumeId></ebs></item>
+                        <item><deviceName>/dev/sdf</deviceName><ebs><volumeId>vol-72d8f579</volumeId></ebs></item>
+                        <item><deviceName>/dev/sdg</deviceName><ebs><volumeId>vol-842b078f</volumeId></ebs></item>
+                    </blockDeviceMapping>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`)
+		case "CreateSnapshot":
+			if q.Get("VolumeId") == "vol-842b078f" {
+				w.WriteHeader(400)
+				fmt.Fprint(w, `<Response><Errors><Error><Code>SnapshotCreationPerVolumeRateExceeded</Code><Message>Rate exceeded</Message></Error></Errors></Response>`)
+				return
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateSnapshotResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotId>snap-1a2b3c4d</snapshotId>
+    <volumeId>vol-72d8f579</volumeId>
+    <status>pending</status>
+</CreateSnapshotResponse>`)
+		case "DetachVolume":
+			mu.Lock()
+			detaching = append(detaching, q.Get("VolumeId"))
+			mu.Unlock()
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DetachVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeId>%s</volumeId>
+    <status>detaching</status>
+</DetachVolumeResponse>`, q.Get("VolumeId"))
+		case "DescribeVolumes":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>%s</volumeId>
+            <status>available</status>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, q.Get("VolumeId.1"))
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+
+	snapshots, detached, err := PrepareForTermination(context.Background(), sr, "i-7ae3b239", true)
+	if err == nil || !strings.Contains(err.Error(), "vol-842b078f") {
+		t.Error("Expected the failed snapshot of vol-842b078f to be reported, got", err)
+	}
+	if len(snapshots) != 1 || snapshots[0] != "snap-1a2b3c4d" {
+		t.Error("Expected one snapshot, got", snapshots)
+	}
+	sort.Strings(detaching)
+	if fmt.Sprint(detaching) != "[vol-72d8f579 vol-842b078f]" {
+		t.Error("Expected every volume but the root device to be detached, got", detaching)
+	}
+	if len(detached) != 2 {
+		t.Error("Expected both volumes to be detached, got", detached)
+	}
+}
+
+func TestDeleteVolumes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if a := "DeleteVolume"; q.Get("Action") != a {
+			t.Errorf("Expected Action to be %s", a)
+		}
+		switch id := q.Get("VolumeId"); id {
+		case "vol-gone":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `<Response><Errors><Error><Code>InvalidVolume.NotFound</Code><Message>The volume '%s' does not exist.</Message></Error></Errors></Response>`, id)
+		case "vol-attached":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `<Response><Errors><Error><Code>VolumeInUse</Code><Message>Volume %s is currently attached to i-7ae3b239</Message></Error></Errors></Response>`, id)
+		default:
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DeleteVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</DeleteVolumeResponse>`)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	result := DeleteVolumes(context.Background(), sr, []string{"vol-72d8f579", "vol-gone", "vol-attached"})
+	deleted, failed := result.Succeeded, result.Failed
+	sort.Strings(deleted)
+	if len(deleted) != 2 || deleted[0] != "vol-72d8f579" || deleted[1] != "vol-gone" {
+		t.Error("Expected existing and already deleted volume to be deleted, got", deleted)
+	}
+	if len(failed) != 1 || ErrorCode(failed["vol-attached"]) != "VolumeInUse" {
+		t.Error("Expected attached volume to fail, got", failed)
+	}
+}
+
+func TestCreateVolumeInAZs(t *testing.T) {
+	var mu sync.Mutex
+	tagged := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "CreateVolume":
+			az := q.Get("AvailabilityZone")
+			if az == "eu-west-1c" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `<Response><Errors><Error><Code>InsufficientVolumeCapacity</Code><Message>There is not enough capacity to fulfill your request.</Message></Error></Errors></Response>`)
+				return
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeId>vol-%s</volumeId>
+    <availabilityZone>%s</availabilityZone>
+    <status>creating</status>
+</CreateVolumeResponse>`, az, az)
+		case "CreateTags":
+			if q.Get("Tag.1.Key") != "Name" || q.Get("Tag.1.Value") != "replica" {
+				t.Error("Unexpected tags", q)
+			}
+			mu.Lock()
+			tagged++
+			mu.Unlock()
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	spec := VolumeSpec{Size: 20, AZ: "ignored", Tags: []TagItem{{"Name", "replica"}}}
+
+	vols, err := CreateVolumeInAZs(context.Background(), sr, spec, []string{"eu-west-1a", "eu-west-1b", "eu-west-1c"})
+	if err == nil || !strings.Contains(err.Error(), "eu-west-1c: InsufficientVolumeCapacity") {
+		t.Error("Expected the failure in eu-west-1c to be reported, got", err)
+	}
+	if len(vols) != 2 || vols["eu-west-1a"].Id != "vol-eu-west-1a" || vols["eu-west-1b"].AvailabilityZone != "eu-west-1b" {
+		t.Error("Expected a volume in each of the other zones, got", vols)
+	}
+	if tagged != 2 {
+		t.Error("Expected both volumes to be tagged, got", tagged)
+	}
+}
+
+func TestCreateVolumeInAZsClientToken(t *testing.T) {
+	var mu sync.Mutex
+	tokens := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		az := q.Get("AvailabilityZone")
+		mu.Lock()
+		tokens[az] = q.Get("ClientToken")
+		mu.Unlock()
+		fmt.Fprintf(w, `<CreateVolumeResponse><volumeId>vol-%s</volumeId><availabilityZone>%s</availabilityZone></CreateVolumeResponse>`, az, az)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	spec := VolumeSpec{Size: 20, VolumeType: "gp3", ClientToken: "replicas-1"}
+
+	if _, err := CreateVolumeInAZs(context.Background(), sr, spec, []string{"eu-west-1a", "eu-west-1b"}); err != nil {
+		t.Fatal(err)
+	}
+	e := map[string]string{"eu-west-1a": "replicas-1-eu-west-1a", "eu-west-1b": "replicas-1-eu-west-1b"}
+	if !reflect.DeepEqual(tokens, e) {
+		t.Errorf("Expected a distinct token per zone %v, got %v", e, tokens)
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, max := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > max {
+			max = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprint(w, `<Response><return>true</return></Response>`)
+	}))
+	defer ts.Close()
+
+	sem := NewSemaphore(2)
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithSemaphore(sem))
+
+	ids := []string{"a", "b", "c", "d", "e", "f"}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := DeleteSnapshots(context.Background(), sr, ids).Err(); err != nil {
+			t.Error(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := DeleteVolumes(context.Background(), sr, ids).Err(); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+
+	if max > 2 {
+		t.Error("Expected at most 2 requests in flight across both batches, got", max)
+	}
+	if len(sem) != 0 {
+		t.Error("Expected every slot to be released, got", len(sem))
+	}
+}
+
+// slotClock records how many slots of the semaphore are held whenever it is asked to sleep.
+type slotClock struct {
+	*fakeClock
+	sem  Semaphore
+	held []int
+}
+
+func (c *slotClock) After(d time.Duration) <-chan time.Time {
+	c.held = append(c.held, len(c.sem))
+	return c.fakeClock.After(d)
+}
+
+func TestCreateSnapshotsThrottled(t *testing.T) {
+	throttled := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "CreateSnapshot" || q.Get("TagSpecification.1.Tag.1.Key") != "backup" {
+			t.Error("Unexpected request", q)
+		}
+		id := q.Get("VolumeId")
+		switch {
+		case id == "vol-busy" && throttled > 0:
+			throttled--
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>SnapshotCreationPerVolumeRateExceeded</Code><Message>Rate exceeded</Message></Error></Errors></Response>`)
+		case id == "vol-gone":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `<Response><Errors><Error><Code>InvalidVolume.NotFound</Code><Message>The volume '%s' does not exist.</Message></Error></Errors></Response>`, id)
+		default:
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateSnapshotResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotId>snap-%s</snapshotId>
+    <volumeId>%s</volumeId>
+    <status>pending</status>
+</CreateSnapshotResponse>`, id, id)
+		}
+	}))
+	defer ts.Close()
+
+	sem := NewSemaphore(1)
+	clock := &slotClock{fakeClock: newFakeClock(), sem: sem}
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(clock), WithSemaphore(sem))
+
+	snaps, err := CreateSnapshotsThrottled(context.Background(), sr, []string{"vol-busy", "vol-idle", "vol-gone"}, "nightly", []TagItem{{"backup", "nightly"}})
+	if err == nil || !strings.Contains(err.Error(), "vol-gone: InvalidVolume.NotFound") {
+		t.Error("Expected the missing volume to be reported, got", err)
+	}
+	if len(snaps) != 2 || snaps["vol-busy"].Id != "snap-vol-busy" || snaps["vol-idle"].Id != "snap-vol-idle" {
+		t.Error("Expected a snapshot of the other volumes, got", snaps)
+	}
+	if e := []time.Duration{15 * time.Second, 30 * time.Second}; fmt.Sprint(clock.sleeps) != fmt.Sprint(e) {
+		t.Errorf("Expected to back off %v, got %v", e, clock.sleeps)
+	}
+
+	// With the only slot released while backing off, nothing else holds it when snapshotting a single volume.
+	throttled, clock.held = 2, nil
+	if _, err := CreateSnapshotsThrottled(context.Background(), sr, []string{"vol-busy"}, "nightly", []TagItem{{"backup", "nightly"}}); err != nil {
+		t.Error("Expected the volume to be snapshotted, got", err)
+	}
+	if fmt.Sprint(clock.held) != "[0 0]" {
+		t.Error("Expected the slot to be released while backing off, slots held", clock.held)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CreateSnapshotsThrottled(ctx, sr, []string{"vol-idle"}, "nightly", nil); err == nil {
+		t.Error("Expected cancelled context to prevent snapshots")
+	}
+}
+
+func TestDetachAllVolumesSemaphore(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, max, detached := 0, 0, 0
+	var pollOnce sync.Once
+	polling, deleted := make(chan struct{}), make(chan struct{})
+	starved := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeInstances":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <rootDeviceName>/dev/sda1</rootDeviceName>
+                    <blockDeviceMapping>
+                        <item><deviceName>/dev/sda1</deviceName><ebs><volumeId>vol-root</volumeId></ebs></item>
+                        <item><deviceName>/dev/sdf</deviceName><ebs><volumeId>vol-f</volumeId></ebs></item>
+                        <item><deviceName>/dev/sdg</deviceName><ebs><volumeId>vol-g</volumeId></ebs></item>
+                        <item><deviceName>/dev/sdh</deviceName><ebs><volumeId>vol-h</volumeId></ebs></item>
+                    </blockDeviceMapping>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`)
+		case "DescribeVolumes":
+			// The volumes only become available once the snapshots were deleted while waiting for them.
+			pollOnce.Do(func() { close(polling) })
+			select {
+			case <-deleted:
+			case <-time.After(2 * time.Second):
+				mu.Lock()
+				starved = true
+				mu.Unlock()
+			}
+			fmt.Fprintf(w, `<DescribeVolumesResponse><volumeSet><item><volumeId>%s</volumeId><status>available</status></item></volumeSet></DescribeVolumesResponse>`, q.Get("VolumeId.1"))
+		case "DetachVolume", "DeleteSnapshot":
+			mu.Lock()
+			inFlight++
+			if inFlight > max {
+				max = inFlight
+			}
+			if action == "DetachVolume" {
+				detached++
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			fmt.Fprintf(w, `<%sResponse><return>true</return></%sResponse>`, action, action)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sem := NewSemaphore(2)
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithSemaphore(sem), WithClock(newFakeClock()))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if result, err := DetachAllVolumes(context.Background(), sr, "i-7ae3b239", true); err != nil || result.Err() != nil {
+			t.Error(err, result.Err())
+		} else if fmt.Sprint(result.Succeeded) != "[vol-f vol-g vol-h]" {
+			t.Error("Expected every data volume to be detached, got", result.Succeeded)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		<-polling
+		if err := DeleteSnapshots(context.Background(), sr, []string{"snap-a", "snap-b", "snap-c"}).Err(); err != nil {
+			t.Error(err)
+		}
+		close(deleted)
+	}()
+	wg.Wait()
+
+	if max > 2 {
+		t.Error("Expected at most 2 requests in flight across both batches, got", max)
+	}
+	if starved {
+		t.Error("Expected the snapshots to be deleted while waiting for the volumes")
+	}
+	if len(sem) != 0 {
+		t.Error("Expected every slot to be released, got", len(sem))
+	}
+
+	detached = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := DetachAllVolumes(ctx, sr, "i-7ae3b239", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detached != 0 || len(result.Succeeded) != 0 || result.Failed["vol-f"] != context.Canceled {
+		t.Error("Expected cancelled context to prevent detaching, got", detached, result.Failed)
+	}
+}
@@ -1,15 +1,18 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"github.com/codegangsta/cli"
 	"github.com/joonix/aws"
 	"log"
 	"net/http"
 	"os"
-	"time"
+	"strings"
+	"text/tabwriter"
 )
 
 var sslClient *http.Client
@@ -20,115 +23,176 @@ func init() {
 	sslClient = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
 }
 
-func detachEbs(c *cli.Context) {
-	sr := aws.NewSignedRequester(sslClient, c.GlobalString("endpoint"), nil)
+// httpClient returns the client to send requests with, logging them to stderr if --debug is set.
+func httpClient(c *cli.Context) *http.Client {
+	if !c.GlobalBool("debug") {
+		return sslClient
+	}
+	return &http.Client{Transport: &aws.LoggingTransport{Transport: sslClient.Transport}}
+}
 
-	tags := []aws.TagItem{
-		aws.TagItem{"Name", c.String("name")},
+// requester signs using the credentials of the profile if one is specified, otherwise using the default signer.
+// A region derives the endpoint and the signing region of profiles, an explicit endpoint still takes precedence.
+func requester(c *cli.Context) aws.SignedRequester {
+	var opts []aws.Option
+	if c.GlobalBool("dry-run") {
+		opts = append(opts, aws.DryRun())
 	}
-	vols, err := aws.VolumesByTags(sr, tags)
+
+	region := c.GlobalString("region")
+	if region == "" {
+		return aws.NewSignedRequester(httpClient(c), c.GlobalString("endpoint"), signer(c), opts...)
+	}
+	if err := aws.ValidateRegion(region); err != nil {
+		log.Fatal(err)
+	}
+
+	endpoint := aws.EndpointForRegion(region)
+	if c.GlobalIsSet("endpoint") {
+		endpoint = c.GlobalString("endpoint")
+	}
+	s, err := signerFor(c.GlobalString("profile"), aws.WithSigningRegion(region))
 	if err != nil {
-		log.Fatalf("Not able to find the volume by name %s: %s", c.String("name"), err)
+		log.Fatalf("Could not use profile %s: %s", c.GlobalString("profile"), err)
 	}
+	return aws.NewSignedRequester(httpClient(c), endpoint, s, opts...)
+}
 
-	if len(vols) != 1 {
-		log.Fatalf("Expected exactly one volume by the name %s", c.String("name"))
+// wouldSucceed reports whether err tells that a request sent in dry-run mode would have succeeded, printing
+// what would have been done if so.
+func wouldSucceed(err error, format string, args ...interface{}) bool {
+	if !aws.IsDryRunSuccess(err) {
+		return false
 	}
-	status, err := aws.DetachVolume(sr, vols[0].Id)
+	fmt.Printf("Would succeed: "+format+"\n", args...)
+	return true
+}
+
+// signer returns the signer of the profile if one is specified, nil meaning the default signer otherwise.
+func signer(c *cli.Context, opts ...aws.SignerOption) aws.Signer {
+	profile := c.GlobalString("profile")
+	signer, err := signerFor(profile, opts...)
 	if err != nil {
-		log.Fatalf("Could not detach volume: %s", err)
+		log.Fatalf("Could not use profile %s: %s", profile, err)
 	}
-	log.Println(status)
+	return signer
 }
 
-func attachEbs(c *cli.Context) {
-	sr := aws.NewSignedRequester(sslClient, c.GlobalString("endpoint"), nil)
+// signerFor returns the signer of the profile configured by opts, or nil without a profile. The default signer
+// is kept then rather than signing with the environment only, since it also finds the credentials of the
+// instance role and reads the region from the endpoint.
+func signerFor(profile string, opts ...aws.SignerOption) (aws.Signer, error) {
+	if profile == "" {
+		return nil, nil
+	}
+	return aws.NewProfileSigner(profile, opts...)
+}
+
+func whoami(c *cli.Context) {
+	// The global endpoint of STS only accepts requests signed for us-east-1.
+	sts := signer(c, aws.WithSigningService("sts"), aws.WithSigningRegion("us-east-1"))
+	sr := aws.NewSignedRequester(httpClient(c), "https://sts.amazonaws.com", sts)
+
+	account, arn, userId, err := aws.CallerIdentity(sr)
+	if err != nil {
+		log.Fatalf("Could not get the caller identity: %s", err)
+	}
+	fmt.Printf("Account: %s\nArn: %s\nUserId: %s\n", account, arn, userId)
+}
+
+func detachEbs(c *cli.Context) {
+	sr := requester(c)
 
-	// See if a volume already exists and is in the same AZ as us
 	tags := []aws.TagItem{
 		aws.TagItem{"Name", c.String("name")},
 	}
 	vols, err := aws.VolumesByTags(sr, tags)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatalf("Not able to find the volume by name %s: %s", c.String("name"), err)
+	}
+
+	if len(vols) != 1 {
+		log.Fatalf("Expected exactly one volume by the name %s", c.String("name"))
 	}
-	if len(vols) > 1 {
-		log.Fatalf("More than one volume exist with the name %s", c.String("name"))
+	vol := vols[0]
+	att := vol.Attachment()
+	if att == nil {
+		log.Printf("Volume %s is not attached\n", vol.Id)
+		return
 	}
 
-	// TODO: Try getting from EC2 metadata service if empty
-	instanceAz := c.String("az")
-	instanceId := c.String("instance")
+	if _, err := aws.DetachVolume(sr, vol.Id); wouldSucceed(err, "detach volume %s from %s at %s", vol.Id, att.InstanceId, att.Device) {
+		return
+	} else if err != nil {
+		log.Fatalf("Could not detach volume: %s", err)
+	}
+	if c.Bool("wait") {
+		if _, err := aws.WaitForDetach(context.Background(), sr, vol.Id, nil); err != nil {
+			log.Fatalf("Failed waiting for volume %s to be detached: %s", vol.Id, err)
+		}
+		log.Printf("Detached volume %s from %s at %s\n", vol.Id, att.InstanceId, att.Device)
+		return
+	}
+	log.Printf("Detaching volume %s from %s at %s\n", vol.Id, att.InstanceId, att.Device)
+}
 
-	snapshot := c.String("snapshot")
+func attachEbs(c *cli.Context) {
+	sr := requester(c)
 
-	var volume *aws.EbsVolume
-	if len(vols) == 1 {
-		if vols[0].AvailabilityZone != instanceAz {
-			// Volume needs to be migrated to the same AZ as the instance by using a snapshot.
-			snap, err := aws.CreateSnapshot(sr, vols[0].Id, "migrate_zone")
-			if err != nil {
-				log.Fatalf("Error creating snapshot: %s", err)
+	instanceAz := c.String("az")
+	instanceId := c.String("instance")
+	if instanceAz == "" || instanceId == "" {
+		// Default to the instance we are running on.
+		metadata := aws.NewMetadataClient()
+		var err error
+		if instanceAz == "" {
+			if instanceAz, err = metadata.GetContext(context.Background(), "placement/availability-zone"); err != nil {
+				log.Fatalf("No availability zone specified and could not read it from the metadata service: %s", err)
 			}
-			// TODO: Prune old migration snapshots
-			snapshot = snap.Id
-
-			wait := make(chan bool)
-			go func() {
-				defer close(wait)
-				for {
-					time.Sleep(time.Second)
-					snap, err := aws.SnapshotById(sr, snapshot)
-					if err != nil {
-						log.Fatalf("Could not update snapshot status for %s", snapshot)
-					}
-					if snap.Status == aws.SnapshotCompleted {
-						return
-					}
-				}
-			}()
-			select {
-			case <-time.After(10 * time.Minute):
-				log.Fatalf("Timed out waiting for snapshot %s to complete", snapshot)
-			case <-wait:
-				log.Println("Created snapshot", snapshot)
-				if err := aws.DeleteVolume(sr, vols[0].Id); err != nil {
-					log.Printf("WARNING: Was not able to delete old volume %s\n", vols[0].Id)
-				}
+		}
+		if instanceId == "" {
+			if instanceId, err = metadata.GetContext(context.Background(), "instance-id"); err != nil {
+				log.Fatalf("No instance specified and could not read it from the metadata service: %s", err)
 			}
-		} else {
-			// Same AZ, we can attach the already existing volume.
-			volume = &vols[0]
-			log.Println("Re-Used volume from same AZ", volume.Id)
 		}
 	}
 
-	if volume == nil {
-		var err error
-		if volume, err = aws.CreateVolume(sr, uint(c.Int("size")), uint(c.Int("piops")), c.Bool("ssd"), instanceAz, snapshot, tags); err != nil {
-			log.Fatal(err)
-		} else {
-			wait := make(chan bool)
-			go func() {
-				defer close(wait)
-				for {
-					time.Sleep(time.Second)
-					if volume, err = aws.VolumeById(sr, volume.Id); err != nil {
-						log.Fatalf("Could not update volume status for %s", volume.Id)
-					}
-					if volume.Status == aws.VolumeAvailable {
-						return
-					}
-				}
-			}()
-
-			select {
-			case <-time.After(10 * time.Minute):
-				log.Fatalf("Timed out waiting for volume %s to become available", volume.Id)
-			case <-wait:
-				log.Println("Created volume", volume.Id)
-			}
+	spec := aws.VolumeSpec{
+		Size:       uint(c.Int("size")),
+		Iops:       uint(c.Int("piops")),
+		SSD:        c.Bool("ssd"),
+		AZ:         instanceAz,
+		SnapshotId: c.String("snapshot"),
+	}
+	volume, created, err := aws.EnsureVolume(context.Background(), sr, c.String("name"), spec)
+	if wouldSucceed(err, "create volume %s in %s", c.String("name"), instanceAz) {
+		return
+	} else if err != nil {
+		log.Fatalf("Could not get volume %s: %s", c.String("name"), err)
+	}
+
+	if created {
+		log.Println("Created volume", volume.Id)
+	} else if volume.NeedsMigration(instanceAz) {
+		// Volume needs to be migrated to the same AZ as the instance by using a snapshot.
+		tags := []aws.TagItem{
+			aws.TagItem{"Name", c.String("name")},
+		}
+		id := volume.Id
+		if volume, err = aws.MigrateVolumeToAZ(context.Background(), sr, id, instanceAz, tags); wouldSucceed(err, "migrate volume %s to %s", id, instanceAz) {
+			return
+		} else if volume == nil {
+			log.Fatalf("Could not migrate volume %s to %s: %s", id, instanceAz, err)
+		} else if err != nil {
+			log.Printf("WARNING: %s\n", err)
+		}
+		log.Printf("Migrated volume %s to %s as %s\n", id, instanceAz, volume.Id)
+	} else {
+		// Same AZ, we can attach the already existing volume unless another instance uses it.
+		if !volume.CanReuseIn(instanceAz, instanceId) {
+			log.Fatalf("Volume %s can not be attached to %s, it is %s", volume.Id, instanceId, volume.Status)
 		}
+		log.Println("Re-Used volume from same AZ", volume.Id)
 	}
 
 	// Check if we already have this volume attached to this instance
@@ -140,18 +204,158 @@ func attachEbs(c *cli.Context) {
 		}
 	}
 
-	// Finally attach volume and print path
-	path, err := aws.AttachVolume(sr, volume.Id, instanceId)
-	if err != nil {
+	// Finally attach volume and print path, the volume is already known to be in our AZ
+	path, err := aws.AttachVolume(sr, volume.Id, instanceId, aws.SkipZoneCheck())
+	if wouldSucceed(err, "attach volume %s to %s at %s", volume.Id, instanceId, path) {
+		return
+	} else if err != nil {
 		log.Fatalf("Could not attach volume: %s\n", err)
 	}
 	fmt.Println(path)
 }
 
+// parseTags turns key=value pairs into tags.
+func parseTags(pairs []string) []aws.TagItem {
+	tags := make([]aws.TagItem, 0, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			log.Fatalf("Invalid tag %s, expected key=value", pair)
+		}
+		tags = append(tags, aws.TagItem{kv[0], kv[1]})
+	}
+	return tags
+}
+
+type volumeRow struct {
+	Id               string `json:"id"`
+	Size             uint   `json:"size"`
+	Type             string `json:"type"`
+	Status           string `json:"status"`
+	AvailabilityZone string `json:"availabilityZone"`
+	Instance         string `json:"instance,omitempty"`
+}
+
+func listEbs(c *cli.Context) {
+	sr := requester(c)
+
+	var vols []aws.EbsVolume
+	var err error
+	if tags := parseTags(c.StringSlice("tag")); len(tags) > 0 {
+		vols, err = aws.VolumesByTags(sr, tags)
+	} else {
+		vols, err = aws.AllVolumes(sr)
+	}
+	if err != nil {
+		log.Fatalf("Could not list volumes: %s", err)
+	}
+
+	rows := make([]volumeRow, len(vols))
+	for n, vol := range vols {
+		rows[n] = volumeRow{vol.Id, vol.Size, vol.VolumeType, vol.Status.String(), vol.AvailabilityZone, ""}
+		if len(vol.AttachmentSet.Items) > 0 {
+			rows[n].Instance = vol.AttachmentSet.Items[0].InstanceId
+		}
+	}
+
+	switch c.String("output") {
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(rows); err != nil {
+			log.Fatal(err)
+		}
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSIZE\tTYPE\tSTATUS\tAZ\tINSTANCE")
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", row.Id, row.Size, row.Type, row.Status, row.AvailabilityZone, row.Instance)
+		}
+		w.Flush()
+	default:
+		log.Fatalf("Unknown output format %s, expected table or json", c.String("output"))
+	}
+}
+
+func cleanupEbs(c *cli.Context) {
+	sr := requester(c)
+
+	tags := parseTags(c.StringSlice("tag"))
+	if len(tags) == 0 {
+		log.Fatal("At least one --tag is required to select what to delete")
+	}
+
+	vols, err := aws.VolumesByTags(sr, tags)
+	if err != nil {
+		log.Fatalf("Could not list volumes: %s", err)
+	}
+	snaps, err := aws.SnapshotsByTags(sr, tags)
+	if err != nil {
+		log.Fatalf("Could not list snapshots: %s", err)
+	}
+
+	var volIds, attached, snapIds []string
+	for _, vol := range vols {
+		volIds = append(volIds, vol.Id)
+		if len(vol.AttachmentSet.Items) > 0 {
+			attached = append(attached, vol.Id)
+			fmt.Printf("Volume %s attached to %s\n", vol.Id, vol.AttachmentSet.Items[0].InstanceId)
+		} else {
+			fmt.Printf("Volume %s\n", vol.Id)
+		}
+	}
+	for _, snap := range snaps {
+		snapIds = append(snapIds, snap.Id)
+		fmt.Printf("Snapshot %s\n", snap.Id)
+	}
+
+	if len(attached) > 0 && !c.Bool("force") {
+		log.Fatalf("Refusing to delete attached volumes %s without --force", strings.Join(attached, ", "))
+	}
+	if len(volIds)+len(snapIds) == 0 {
+		log.Println("Nothing to delete")
+		return
+	}
+	if !c.Bool("yes") {
+		log.Println("Run again with --yes to delete the above")
+		return
+	}
+
+	ctx := context.Background()
+	for _, id := range attached {
+		if _, err := aws.DetachVolume(sr, id); err != nil {
+			log.Fatalf("Could not detach volume %s: %s", id, err)
+		}
+	}
+	for _, id := range attached {
+		if _, err := aws.WaitForVolumeStatus(ctx, sr, id, aws.VolumeAvailable, nil); err != nil {
+			log.Fatalf("Failed waiting for volume %s to be detached: %s", id, err)
+		}
+	}
+
+	failures := 0
+	result := aws.DeleteVolumes(ctx, sr, volIds)
+	log.Printf("Deleted %d volumes\n", len(result.Succeeded))
+	for id, err := range result.Failed {
+		log.Printf("Could not delete volume %s: %s\n", id, err)
+		failures++
+	}
+	result = aws.DeleteSnapshots(ctx, sr, snapIds)
+	log.Printf("Deleted %d snapshots\n", len(result.Succeeded))
+	for id, err := range result.Failed {
+		log.Printf("Could not delete snapshot %s: %s\n", id, err)
+		failures++
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
 func associateEip(c *cli.Context) {
-	sr := aws.NewSignedRequester(sslClient, c.GlobalString("endpoint"), nil)
+	sr := requester(c)
 
-	if err := aws.AssociateAddress(sr, c.String("instance"), c.String("ip")); err != nil {
+	err := aws.AssociateAddress(sr, c.String("instance"), c.String("ip"))
+	if wouldSucceed(err, "associate %s with %s", c.String("ip"), c.String("instance")) {
+		return
+	} else if err != nil {
 		log.Fatalf("Could not associate ip: %s", err)
 	}
 	fmt.Println(c.String("ip"))
@@ -169,8 +373,29 @@ func main() {
 			Usage: "The AWS endpoint to use",
 			Value: "https://ec2.eu-west-1.amazonaws.com",
 		},
+		cli.StringFlag{
+			Name:  "region",
+			Usage: "The AWS region to use, deriving the endpoint unless one is given explicitly",
+		},
+		cli.StringFlag{
+			Name:  "profile",
+			Usage: "The profile of the shared AWS credentials file to use instead of environment variables",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Log requests and responses to stderr, with signatures redacted",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only check permissions and parameters, printing what would be done without making changes",
+		},
 	}
 	app.Commands = []cli.Command{
+		{
+			Name:   "whoami",
+			Usage:  "show the account and identity the credentials belong to",
+			Action: whoami,
+		},
 		{
 			Name:  "ebs",
 			Usage: "options for Elastic Block Storage",
@@ -228,9 +453,50 @@ func main() {
 							Usage:  "name tag of volume to detach",
 							EnvVar: "EBS_DETACH_NAME",
 						},
+						cli.BoolFlag{
+							Name:  "wait",
+							Usage: "wait for the volume to be detached",
+						},
 					},
 					Action: detachEbs,
 				},
+				{
+					Name:  "list",
+					Usage: "list volumes matching tags",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "tag",
+							Usage: "key=value tag the volumes must have, can be repeated",
+							Value: &cli.StringSlice{},
+						},
+						cli.StringFlag{
+							Name:  "output",
+							Usage: "output format, table or json",
+							Value: "table",
+						},
+					},
+					Action: listEbs,
+				},
+				{
+					Name:  "cleanup",
+					Usage: "delete all volumes and snapshots matching tags",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "tag",
+							Usage: "key=value tag the resources must have, can be repeated",
+							Value: &cli.StringSlice{},
+						},
+						cli.BoolFlag{
+							Name:  "yes",
+							Usage: "delete the resources instead of only listing them",
+						},
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "detach attached volumes before deleting them",
+						},
+					},
+					Action: cleanupEbs,
+				},
 			},
 		},
 		{
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/joonix/aws"
+	"testing"
+)
+
+func TestSignerForRegionWithoutProfile(t *testing.T) {
+	s, err := signerFor("", aws.WithSigningRegion("us-east-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != nil {
+		t.Errorf("Expected the default signer to be kept without a profile, got %T", s)
+	}
+}
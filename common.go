@@ -1,18 +1,42 @@
 package aws
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"github.com/smartystreets/go-aws-auth"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // DefaultSigner provides a working Signer using the smartystreets awsauth library.
 var DefaultSigner = SignerFunc(func(r *http.Request) {
+	// awsauth only knows the legacy AWS_SECURITY_TOKEN variable, make sure AWS_SESSION_TOKEN is signed as well.
+	if creds := EnvCredentials(); creds.AccessKeyId != "" && creds.SecurityToken != "" {
+		awsauth.Sign(r, awsauth.Credentials{
+			AccessKeyID:     creds.AccessKeyId,
+			SecretAccessKey: creds.SecretAccessKey,
+			SecurityToken:   creds.SecurityToken,
+		})
+		return
+	}
 	awsauth.Sign(r)
 })
 
+// NoopSigner leaves requests unsigned, e.g. for emulators not verifying signatures.
+var NoopSigner = SignerFunc(func(r *http.Request) {})
+
 // Signer describes how to Sign requests before sending them to Amazon Web Services API.
 type Signer interface {
 	Sign(*http.Request)
@@ -25,12 +49,82 @@ func (f SignerFunc) Sign(r *http.Request) {
 	f(r)
 }
 
+// RequestBuilder creates the HTTP request sending the parameters, including the Action, to the endpoint.
+type RequestBuilder interface {
+	BuildRequest(endpoint string, values url.Values) (*http.Request, error)
+}
+
+// RequestBuilderFunc wraps a function to implement the RequestBuilder interface.
+type RequestBuilderFunc func(endpoint string, values url.Values) (*http.Request, error)
+
+func (f RequestBuilderFunc) BuildRequest(endpoint string, values url.Values) (*http.Request, error) {
+	return f(endpoint, values)
+}
+
+// QueryRequestBuilder sends the parameters in the query string of a GET request, used by default.
+var QueryRequestBuilder = RequestBuilderFunc(func(endpoint string, values url.Values) (*http.Request, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = values.Encode()
+	return req, nil
+})
+
+// FormRequestBuilder sends the parameters as a form in the body of a POST request, which every query API
+// accepts and which isn't limited by the length of URLs.
+var FormRequestBuilder = RequestBuilderFunc(func(endpoint string, values url.Values) (*http.Request, error) {
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	return req, nil
+})
+
 type TagItem struct {
 	Key   string `xml:"key"`
 	Value string `xml:"value"`
 }
 
-// SignedRequester handles talking with the Amazon API and signing of our requests.
+// Timestamp is a time.Time tolerating the different layouts of timestamps found in AWS responses.
+type Timestamp struct {
+	time.Time
+}
+
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	time.RFC1123,
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, which encoding/xml calls with the character data of the
+// element without the overhead of a nested DecodeElement.
+func (t *Timestamp) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown timestamp format %s", s)
+}
+
+const (
+	// apiVersion of EC2 used unless the request specifies another one.
+	apiVersion = "2014-05-01"
+	// latestAPIVersion of EC2 needed by the actions introduced after apiVersion.
+	latestAPIVersion = "2016-11-15"
+)
+
+// SignedRequester handles talking with the Amazon API and signing of our requests. The requesters returned by
+// NewSignedRequester are safe for concurrent use and never modify the values passed to them.
 type SignedRequester interface {
 	SignedRequest(v url.Values) ([]byte, error)
 }
@@ -38,37 +132,191 @@ type SignedRequester interface {
 type awsClient struct {
 	client   *http.Client
 	endpoint string
+	builder  RequestBuilder
 	signer   Signer
+	strict   bool
+	retry    RetryConfig
+	budget   *retryBudget
+	clock    Clock
+	// version is sent with requests not specifying one, defaults to apiVersion.
+	version string
+	// overrides maps actions to the endpoint they are sent to instead of endpoint.
+	overrides map[string]string
+	// insecure disables TLS verification when no http.Client was provided, see WithInsecureSkipVerify.
+	insecure bool
+	// dryRun asks Amazon to only check permissions and parameters of requests changing anything, see DryRun.
+	dryRun bool
+	// sem is shared by the batch helpers, see WithSemaphore.
+	sem Semaphore
+	// skew is the offset in nanoseconds between Amazon's clock and ours, accessed atomically.
+	skew int64
+}
+
+// Option configures the SignedRequester returned by NewSignedRequester.
+type Option func(*awsClient)
+
+// StrictDecoding makes responses fail to decode when they contain none of the elements expected by the
+// target, rather than silently returning an empty result, e.g. when a field moved between API versions.
+func StrictDecoding() Option {
+	return func(c *awsClient) {
+		c.strict = true
+	}
+}
+
+// WithClock sets the clock used for signing and for waiting between retries, defaults to RealClock.
+func WithClock(clock Clock) Option {
+	return func(c *awsClient) {
+		c.clock = clock
+	}
+}
+
+// WithVersion sets the API version sent with requests that don't specify one, e.g. to use the requester for
+// the query API of another service than EC2 such as STS. Defaults to the EC2 version this package is written for.
+func WithVersion(version string) Option {
+	return func(c *awsClient) {
+		c.version = version
+	}
+}
+
+// DryRun makes Amazon only check whether requests would succeed instead of making any changes, they fail with
+// an error satisfying IsDryRunSuccess if they would have. Read-only Describe and Get requests are sent as usual
+// so that functions looking up resources before changing them still work.
+func DryRun() Option {
+	return func(c *awsClient) {
+		c.dryRun = true
+	}
+}
+
+// WithRequestBuilder changes how requests are sent, e.g. FormRequestBuilder for services expecting POST
+// requests. Defaults to QueryRequestBuilder.
+func WithRequestBuilder(builder RequestBuilder) Option {
+	return func(c *awsClient) {
+		c.builder = builder
+	}
+}
+
+// WithEndpointOverride sends requests for the action to another endpoint than the rest, meant for tests
+// injecting faults into specific actions, e.g. an httptest server failing every DeleteVolume with a 503.
+func WithEndpointOverride(action, endpoint string) Option {
+	return func(c *awsClient) {
+		if c.overrides == nil {
+			c.overrides = make(map[string]string)
+		}
+		c.overrides[action] = endpoint
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the TLS certificate of the endpoint, e.g. for a local mock
+// using a self-signed certificate. It has no effect when an http.Client is passed to NewSignedRequester.
+//
+// WARNING: for tests only, never use it against Amazon. Anyone between us and the endpoint could read and
+// modify requests, including the credentials they are signed with. A warning is logged whenever it's used.
+func WithInsecureSkipVerify() Option {
+	return func(c *awsClient) {
+		c.insecure = true
+	}
 }
 
 // signedRequest applies the signature the the request using provided RequestSigner.
 func (c *awsClient) SignedRequest(v url.Values) ([]byte, error) {
-	req, err := http.NewRequest("GET", c.endpoint, nil)
+	// Work on a copy, the caller may reuse its values or share them between goroutines.
+	values := make(url.Values, len(v)+1)
+	for key, vals := range v {
+		values[key] = append([]string(nil), vals...)
+	}
+	// Version param is required for Amazon to understand the request, actions introduced later specify their own.
+	if values.Get("Version") == "" {
+		values.Set("Version", c.version)
+	}
+	if action := values.Get("Action"); c.dryRun && !strings.HasPrefix(action, "Describe") && !strings.HasPrefix(action, "Get") {
+		values.Set("DryRun", "true")
+	}
+
+	for attempt := 1; ; attempt++ {
+		b, err := c.send(values)
+		if err == nil {
+			if c.budget != nil {
+				c.budget.earn()
+			}
+			return b, nil
+		}
+
+		delay, retry := c.shouldRetry(err, attempt)
+		if !retry {
+			return nil, err
+		}
+		<-c.clock.After(delay)
+	}
+}
+
+// send signs and sends the request once.
+func (c *awsClient) send(v url.Values) ([]byte, error) {
+	endpoint := c.endpoint
+	if override, ok := c.overrides[v.Get("Action")]; ok {
+		endpoint = override
+	}
+	req, err := c.builder.BuildRequest(endpoint, v)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept-Encoding", "gzip")
 
-	// Version param is required for Amazon to understand the request.
-	v.Add("Version", "2014-05-01")
-	req.URL.RawQuery = v.Encode()
-
-	c.signer.Sign(req)
+	if signer, ok := c.signer.(TimeSigner); ok {
+		signer.SignAt(req, c.clock.Now().Add(time.Duration(atomic.LoadInt64(&c.skew))))
+	} else {
+		c.signer.Sign(req)
+	}
 	res, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
-	b, _ := ioutil.ReadAll(res.Body)
+	b, err := readBody(res)
 	if res.StatusCode != 200 {
-		// TODO: Prettier error reply
-		return nil, errors.New(string(b))
+		apiErr := newAPIError(res.StatusCode, b)
+		if apiErr.Code == "" {
+			// REST APIs such as EBS direct answer in JSON, naming the error in a header.
+			apiErr.Code = strings.SplitN(res.Header.Get("X-Amzn-ErrorType"), ":", 2)[0]
+		}
+		apiErr.ServerTime, _ = http.ParseTime(res.Header.Get("Date"))
+		apiErr.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"), c.clock.Now())
+		return nil, apiErr
 	}
 
-	return b, nil
+	return b, err
+}
+
+// readBody reads the response, decompressing it if it was gzipped. Asking for gzip explicitly stops
+// http.Transport from decompressing transparently, so it has to be done here.
+func readBody(res *http.Response) ([]byte, error) {
+	if !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return ioutil.ReadAll(res.Body)
+	}
+	r, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// parseRetryAfter returns the delay of a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
 }
 
 // NewSignedRequester combines the provided http.Client with awsauth to provide a SignedRequester.
-func NewSignedRequester(requester *http.Client, endpoint string, signer Signer) SignedRequester {
+func NewSignedRequester(requester *http.Client, endpoint string, signer Signer, opts ...Option) SignedRequester {
 	c := new(awsClient)
 
 	if endpoint == "" {
@@ -86,6 +334,210 @@ func NewSignedRequester(requester *http.Client, endpoint string, signer Signer)
 	} else {
 		c.signer = signer
 	}
+	c.builder = QueryRequestBuilder
+	c.clock = RealClock
+	c.version = apiVersion
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.insecure && requester == nil {
+		log.Printf("WARNING: TLS verification of %s is disabled, only use WithInsecureSkipVerify for tests", c.endpoint)
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		c.client = &http.Client{Transport: transport}
+	}
+	if c.retry.Budget > 0 {
+		c.budget = newRetryBudget(c.retry.Budget)
+	}
+	c.signer = signerForEndpoint(c.signer, c.endpoint)
 
 	return SignedRequester(c)
 }
+
+// WithEndpoint returns a copy of the requester sending its requests to another endpoint, e.g. to use the same
+// configuration against both LocalStack and Amazon. Requesters not created by NewSignedRequester are returned as is.
+func WithEndpoint(sr SignedRequester, endpoint string) SignedRequester {
+	c, ok := sr.(*awsClient)
+	if !ok {
+		return sr
+	}
+	clone := *c
+	clone.endpoint = endpoint
+	clone.signer = signerForEndpoint(c.signer, endpoint)
+	return &clone
+}
+
+// regionalSigner is implemented by signers whose region can be changed, such as V4Signer and the signers of
+// profiles assuming a role.
+type regionalSigner interface {
+	Signer
+	signingRegion() string
+	// forRegion returns a copy of the signer signing for the region.
+	forRegion(region string) Signer
+}
+
+// signerForEndpoint returns a copy of the signer signing for the region of the endpoint if it differs, since
+// Amazon rejects signatures for another region than the one of the host name with SignatureDoesNotMatch.
+// DefaultSigner infers the region from the host name already, other signers are returned as is.
+func signerForEndpoint(signer Signer, endpoint string) Signer {
+	rs, ok := signer.(regionalSigner)
+	if !ok {
+		return signer
+	}
+	region, ok := RegionFromEndpoint(endpoint)
+	if !ok || region == rs.signingRegion() {
+		return signer
+	}
+	return rs.forRegion(region)
+}
+
+// PresignURL returns a URL for the request that can be used by anyone without credentials until it expires.
+// The requester has to use a signer supporting presigning, such as V4Signer.
+func PresignURL(sr SignedRequester, v url.Values, expires time.Duration) (string, error) {
+	c, ok := sr.(*awsClient)
+	if !ok {
+		return "", errors.New("Presigning requires a requester created by NewSignedRequester")
+	}
+	presigner, ok := c.signer.(Presigner)
+	if !ok {
+		return "", errors.New("The signer of the requester does not support presigning")
+	}
+
+	req, err := http.NewRequest("GET", c.endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	values := url.Values{"Version": []string{c.version}}
+	for key, vals := range v {
+		values[key] = vals
+	}
+	req.URL.RawQuery = values.Encode()
+
+	presigner.Presign(req, expires)
+	return req.URL.String(), nil
+}
+
+// params are the parameters of a request besides its action, see call.
+type params map[string]string
+
+func (p params) Set(key, value string) {
+	p[key] = value
+}
+
+// paramSetter is implemented by both params and url.Values, allowing helpers such as addFilters to build either.
+type paramSetter interface {
+	Set(key, value string)
+}
+
+// call sends a single request for the action and decodes the response into out. A *[]byte out receives the
+// response as is and a nil out discards it, for actions only reporting success.
+func call(sr SignedRequester, action string, params map[string]string, out interface{}) error {
+	values := make(url.Values, len(params)+1)
+	values.Set("Action", action)
+	for key, value := range params {
+		values.Set(key, value)
+	}
+
+	b, err := sr.SignedRequest(values)
+	if err != nil {
+		return err
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*out = b
+		return nil
+	}
+	return decode(sr, b, out)
+}
+
+// decode unmarshals the response into v, verifying that it contained what v expects in strict mode.
+func decode(sr SignedRequester, b []byte, v interface{}) error {
+	if err := xml.Unmarshal(b, v); err != nil {
+		return err
+	}
+	if c, ok := sr.(*awsClient); ok && c.strict {
+		return verifyElements(b, v)
+	}
+	return nil
+}
+
+// verifyElements returns an error if none of the top level elements of the document are known to v.
+func verifyElements(b []byte, v interface{}) error {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var expected []string
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(strings.Split(t.Field(i).Tag.Get("xml"), ",")[0], ">")[0]
+		if name != "" && name != "-" {
+			expected = append(expected, name)
+		}
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+
+	root := ""
+	depth := 0
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				root = el.Name.Local
+			} else if depth == 2 {
+				for _, name := range expected {
+					if el.Name.Local == name {
+						return nil
+					}
+				}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	return fmt.Errorf("Response %s contains none of the expected elements %s", root, strings.Join(expected, ", "))
+}
+
+// paginate issues the request once per page, passing each response to page which returns the token of
+// the next page or an empty string when there are no more.
+func paginate(sr SignedRequester, values url.Values, page func([]byte) (string, error)) error {
+	token := ""
+	for {
+		v := make(url.Values)
+		for key, vals := range values {
+			v[key] = append([]string(nil), vals...)
+		}
+		if token != "" {
+			v.Set("NextToken", token)
+		}
+
+		b, err := sr.SignedRequest(v)
+		if err != nil {
+			return err
+		}
+		if token, err = page(b); err != nil {
+			return err
+		}
+		if token == "" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The volumes are not where EbsVolumeSet expects to find them.
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>8f0ea6b0-8a7c-40f1-bc41-cd2cf2d887d5</requestId>
+    <volumes>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+        </item>
+    </volumes>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	if vols, err := VolumesByTags(sr, []TagItem{{"Name", "test"}}); err != nil || len(vols) != 0 {
+		t.Error("Expected lenient decoding to return no volumes, got", vols, err)
+	}
+
+	sr = NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, StrictDecoding())
+	_, err := VolumesByTags(sr, []TagItem{{"Name", "test"}})
+	if err == nil {
+		t.Fatal("Expected strict decoding to fail")
+	}
+	if e := "Response DescribeVolumesResponse contains none of the expected elements volumeSet, nextToken"; err.Error() != e {
+		t.Error("Unexpected error", err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	responses := []string{
+		`<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>InvalidVolume.NotFound</Code><Message>The volume 'vol-72d8f579' does not exist.</Message></Error></Errors><RequestID>5cd7b2b5-6e0a-4e4a-a7a4-EXAMPLE</RequestID></Response>`,
+		`<?xml version='1.0' encoding='utf-8'?>
+<ErrorResponse><Error><Code>InvalidVolume.NotFound</Code><Message>The volume 'vol-72d8f579' does not exist.</Message></Error><RequestId>5cd7b2b5-6e0a-4e4a-a7a4-EXAMPLE</RequestId></ErrorResponse>`,
+	}
+	for _, response := range responses {
+		err := newAPIError(400, []byte(response))
+		if err.Code != "InvalidVolume.NotFound" || err.RequestId != "5cd7b2b5-6e0a-4e4a-a7a4-EXAMPLE" {
+			t.Error("Unexpected error parsed", err)
+		}
+	}
+
+	if err := newAPIError(503, []byte("Service Unavailable")); err.Error() != "Service Unavailable" {
+		t.Error("Expected unparsable body as message, got", err)
+	}
+}
+
+func TestWithEndpoint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet/>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, "http://localhost:0", DefaultSigner, StrictDecoding())
+	local := WithEndpoint(sr, ts.URL)
+	if _, err := VolumesByTags(local, []TagItem{{"Name", "test"}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := VolumesByTags(sr, []TagItem{{"Name", "test"}}); err == nil {
+		t.Error("Expected original requester to keep its endpoint")
+	}
+	if c := local.(*awsClient); !c.strict {
+		t.Error("Expected options to be kept")
+	}
+}
+
+// TestConcurrentRequests is meant to be run with -race to detect shared state in the requester.
+func TestConcurrentRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-%s</volumeId>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, r.URL.Query().Get("Filter.1.Value.1"))
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, NewV4Signer(Credentials{"AKIDEXAMPLE", "secret", ""}))
+
+	var wg sync.WaitGroup
+	for n := 0; n < 50; n++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			vols, err := VolumesByTags(sr, []TagItem{{"Name", name}})
+			if err != nil {
+				t.Error(err)
+			} else if len(vols) != 1 || vols[0].Id != "vol-"+name {
+				t.Error("Expected the volume of", name, "got", vols)
+			}
+		}(strconv.Itoa(n))
+	}
+	wg.Wait()
+}
+
+func TestSignedRequestKeepsValues(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if versions := r.URL.Query()["Version"]; len(versions) != 1 {
+			t.Error("Expected exactly one Version param, got", versions)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	values := url.Values{"Action": []string{"DescribeVolumes"}}
+	for n := 0; n < 2; n++ {
+		if _, err := sr.SignedRequest(values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(values) != 1 {
+		t.Error("Expected the values of the caller to be left untouched, got", values)
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	expected := time.Date(2014, 10, 6, 11, 43, 23, 0, time.UTC)
+	for _, s := range []string{"2014-10-06T11:43:23.000Z", "2014-10-06T11:43:23Z", "2014-10-06T11:43:23+0000", "2014-10-06T11:43:23"} {
+		snap := new(EbsSnapshot)
+		if err := xml.Unmarshal([]byte("<item><startTime>"+s+"</startTime></item>"), snap); err != nil {
+			t.Error(err)
+		} else if !snap.StartTime.Equal(expected) {
+			t.Errorf("Expected %s to parse as %s, got %s", s, expected, snap.StartTime)
+		}
+	}
+
+	snap := new(EbsSnapshot)
+	if err := xml.Unmarshal([]byte("<item><startTime>yesterday</startTime></item>"), snap); err == nil {
+		t.Error("Expected unknown timestamp format to fail")
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DeleteVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</DeleteVolumeResponse>`)
+	}))
+	defer ts.Close()
+
+	if err := DeleteVolume(NewSignedRequester(nil, ts.URL, NoopSigner), "vol-72d8f579"); err == nil {
+		t.Error("Expected the self-signed certificate to be rejected")
+	}
+	if err := DeleteVolume(NewSignedRequester(nil, ts.URL, NoopSigner, WithInsecureSkipVerify()), "vol-72d8f579"); err != nil {
+		t.Error("Expected the certificate not to be verified, got", err)
+	}
+	// A client passed by the caller is used as is.
+	if err := DeleteVolume(NewSignedRequester(http.DefaultClient, ts.URL, NoopSigner, WithInsecureSkipVerify()), "vol-72d8f579"); err == nil {
+		t.Error("Expected the client of the caller to verify the certificate")
+	}
+}
+
+func TestCall(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeInstanceAttribute" || q.Get("InstanceId") != "i-7ae3b239" || q.Get("Version") != latestAPIVersion {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprint(w, `<DescribeInstanceAttributeResponse><instanceId>i-7ae3b239</instanceId></DescribeInstanceAttributeResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	p := params{"InstanceId": "i-7ae3b239", "Version": latestAPIVersion}
+
+	m := &struct {
+		Id string `xml:"instanceId"`
+	}{}
+	if err := call(sr, "DescribeInstanceAttribute", p, m); err != nil || m.Id != "i-7ae3b239" {
+		t.Error("Expected the response to be decoded, got", m.Id, err)
+	}
+	var b []byte
+	if err := call(sr, "DescribeInstanceAttribute", p, &b); err != nil || !strings.Contains(string(b), "i-7ae3b239") {
+		t.Errorf("Expected the raw response, got %q, %v", b, err)
+	}
+	if err := call(sr, "DescribeInstanceAttribute", p, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// gzipServer serves body, compressed if the request accepts gzip, counting the bytes sent in wire.
+func gzipServer(status int, body []byte, wire *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(&buf)
+			zw.Write(body)
+			zw.Close()
+		} else {
+			buf.Write(body)
+		}
+		atomic.AddInt64(wire, int64(buf.Len()))
+		w.WriteHeader(status)
+		w.Write(buf.Bytes())
+	}))
+}
+
+func TestGzipResponse(t *testing.T) {
+	var wire int64
+	body := largeVolumeResponse(100)
+	ts := gzipServer(200, body, &wire)
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	b, err := sr.SignedRequest(url.Values{"Action": {"DescribeVolumes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, body) {
+		t.Error("Expected the decompressed response")
+	}
+	if wire >= int64(len(body)) {
+		t.Errorf("Expected a compressed response, got %d bytes for %d", wire, len(body))
+	}
+
+	es := gzipServer(400, []byte(`<Response><Errors><Error><Code>InvalidVolume.NotFound</Code><Message>No volume</Message></Error></Errors></Response>`), &wire)
+	defer es.Close()
+
+	sr = NewSignedRequester(http.DefaultClient, es.URL, DefaultSigner)
+	if _, err := sr.SignedRequest(url.Values{"Action": {"DescribeVolumes"}}); ErrorCode(err) != "InvalidVolume.NotFound" {
+		t.Error("Expected the compressed error to be decoded, got", err)
+	}
+}
+
+// BenchmarkGzipResponse compares the bytes transferred for a large DescribeVolumes response with and without
+// compression, reported as wire-B/op.
+func BenchmarkGzipResponse(b *testing.B) {
+	body := largeVolumeResponse(10000)
+	for _, accept := range []bool{false, true} {
+		b.Run(fmt.Sprintf("gzip=%t", accept), func(b *testing.B) {
+			var wire int64
+			ts := gzipServer(200, body, &wire)
+			defer ts.Close()
+			if !accept {
+				// Strip the header so the server sends the response uncompressed.
+				inner := ts.Config.Handler
+				ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					r.Header.Del("Accept-Encoding")
+					inner.ServeHTTP(w, r)
+				})
+			}
+
+			sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := sr.SignedRequest(url.Values{"Action": {"DescribeVolumes"}}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&wire))/float64(b.N), "wire-B/op")
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeVolumes":
+			if q.Get("DryRun") != "" {
+				t.Error("Expected lookups to be sent as usual, got", q)
+			}
+			fmt.Fprint(w, `<DescribeVolumesResponse><volumeSet/></DescribeVolumesResponse>`)
+		case "DeleteVolume":
+			if q.Get("DryRun") != "true" {
+				t.Error("Expected DryRun to be set, got", q)
+			}
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>DryRunOperation</Code><Message>Request would have succeeded, but DryRun flag is set.</Message></Error></Errors></Response>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, DryRun())
+
+	if _, err := VolumesByTags(sr, []TagItem{{"Name", "data"}}); err != nil {
+		t.Error(err)
+	}
+	if err := DeleteVolume(sr, "vol-72d8f579"); !IsDryRunSuccess(err) {
+		t.Error("Expected the dry run to succeed, got", err)
+	}
+	if IsDryRunSuccess(nil) || IsDryRunSuccess(ErrNotFound) {
+		t.Error("Expected only DryRunOperation errors to be dry run successes")
+	}
+}
+
+func TestFormRequestBuilder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.RawQuery != "" {
+			t.Error("Expected a POST without query, got", r.Method, r.URL)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("Action") != "GetCallerIdentity" || r.PostForm.Get("Version") != stsAPIVersion {
+			t.Error("Unexpected form", r.PostForm)
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "content-type") {
+			t.Error("Expected the content type to be signed, got", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult><Account>123456789012</Account></GetCallerIdentityResult></GetCallerIdentityResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, testV4Signer(WithSigningService("sts")), WithRequestBuilder(FormRequestBuilder))
+	if account, _, _, err := CallerIdentity(sr); err != nil || account != "123456789012" {
+		t.Error("Expected the account of the identity, got", account, err)
+	}
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"regexp"
+)
+
+// LoggingTransport dumps requests and responses for debugging, with signatures and session tokens redacted
+// so that the output can be shared. The credential scope, including the access key id, is kept as it helps
+// telling which credentials were used.
+type LoggingTransport struct {
+	// Transport sends the requests, defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+	// Logger defaults to logging to stderr.
+	Logger *log.Logger
+}
+
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(Signature=)[^&,\s]+`),
+	regexp.MustCompile(`(X-Amz-Security-Token=)[^&\s]+`),
+	regexp.MustCompile(`(?im)^(X-Amz-Security-Token: ).*$`),
+}
+
+// redactSecrets replaces the signatures and session tokens found in the dump of a request.
+func redactSecrets(dump []byte) []byte {
+	for _, p := range secretPatterns {
+		dump = p.ReplaceAll(dump, []byte("${1}REDACTED"))
+	}
+	return dump
+}
+
+func (l *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := l.Logger
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	transport := l.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	b, _ := httputil.DumpRequestOut(req, true)
+	logger.Println("\n" + string(redactSecrets(b)))
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		logger.Println("Request failed:", err)
+		return nil, err
+	}
+	// Responses are dumped decompressed, the caller still gets the body as it was sent.
+	b, _ = httputil.DumpResponse(res, false)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	logged := body
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		if r, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+			logged, _ = ioutil.ReadAll(r)
+		}
+	}
+	logger.Println("\n" + string(b) + string(logged))
+	return res, err
+}
@@ -0,0 +1,42 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLoggingTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<DescribeVolumesResponse><volumeSet/></DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	client := &http.Client{Transport: &LoggingTransport{Logger: log.New(&out, "", 0)}}
+	signer := NewV4Signer(Credentials{"AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "session-token"})
+	sr := NewSignedRequester(client, ts.URL, signer)
+
+	if _, err := sr.SignedRequest(url.Values{"Action": {"DescribeVolumes"}}); err != nil {
+		t.Fatal(err)
+	}
+	dump := out.String()
+	if !strings.Contains(dump, "Action=DescribeVolumes") || !strings.Contains(dump, "<volumeSet/>") {
+		t.Error("Expected the request and response to be logged, got", dump)
+	}
+	if !strings.Contains(dump, "Credential=AKIDEXAMPLE/") || !strings.Contains(dump, "Signature=REDACTED") {
+		t.Error("Expected the signature to be redacted, got", dump)
+	}
+	if strings.Contains(dump, "session-token") {
+		t.Error("Expected the session token to be redacted, got", dump)
+	}
+
+	if u := string(redactSecrets([]byte("/?X-Amz-Security-Token=abc&X-Amz-Signature=0123abcd"))); u != "/?X-Amz-Security-Token=REDACTED&X-Amz-Signature=REDACTED" {
+		t.Error("Expected presigned URLs to be redacted, got", u)
+	}
+}
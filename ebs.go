@@ -1,12 +1,17 @@
 package aws
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,7 +20,7 @@ type DeviceMapping struct {
 	Info   struct {
 		Id                  string            `xml:"volumeId"`
 		Status              AttachementStatus `xml:"status"`
-		AttachAt            time.Time         `xml:"attachTime"`
+		AttachAt            Timestamp         `xml:"attachTime"`
 		DeleteOnTermination bool              `xml:"deleteOnTermination"`
 	} `xml:"ebs"`
 }
@@ -27,24 +32,61 @@ var (
 	VolumeAttached  AttachementStatus = "attached"
 	VolumeDetaching AttachementStatus = "detaching"
 	VolumeDetached  AttachementStatus = "detached"
+	VolumeBusy      AttachementStatus = "busy"
 )
 
 func (s AttachementStatus) String() string {
 	return string(s)
 }
 
+// attachementTransitions lists the statuses an attachment can be in when described again after each status.
+// Statuses passed through in between are skipped, so an attached volume can be described as detached once the
+// detachment completed, but not as attaching again, which takes a detachment and a new attachment. Attaching
+// fails straight to detached, e.g. when the device name is already in use, and a volume in use by the instance is
+// busy until it is unmounted or forcibly detached.
+var attachementTransitions = map[AttachementStatus][]AttachementStatus{
+	VolumeAttaching: {VolumeAttached, VolumeBusy, VolumeDetaching, VolumeDetached},
+	VolumeAttached:  {VolumeBusy, VolumeDetaching, VolumeDetached},
+	VolumeBusy:      {VolumeAttached, VolumeDetaching, VolumeDetached},
+	VolumeDetaching: {VolumeBusy, VolumeDetached},
+	VolumeDetached:  {VolumeAttaching, VolumeAttached},
+}
+
+// CanTransitionTo reports whether an attachment in this status can be in the next one when described again.
+// Remaining in the same status is always possible.
+func (s AttachementStatus) CanTransitionTo(next AttachementStatus) bool {
+	if s == next {
+		return true
+	}
+	for _, status := range attachementTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
 type EbsVolumeAttachementResponse struct {
 	InstanceId string            `xml:"instanceId"`
 	VolumeId   string            `xml:"volumeId"`
 	Status     AttachementStatus `xml:"status"`
 	Device     string            `xml:"device"`
+	AttachTime Timestamp         `xml:"attachTime"`
 }
 
 type EbsVolume struct {
 	Id               string       `xml:"volumeId"`
 	AvailabilityZone string       `xml:"availabilityZone"`
+	Size             uint         `xml:"size"`
+	VolumeType       string       `xml:"volumeType"`
+	Iops             uint         `xml:"iops"`
+	Throughput       uint         `xml:"throughput"`
 	Status           VolumeStatus `xml:"status"`
-	CreatedAt        time.Time    `xml:"createTime"`
+	Encrypted        bool         `xml:"encrypted"`
+	SnapshotId       string       `xml:"snapshotId"`
+	OutpostArn       string       `xml:"outpostArn"`
+	MultiAttach      bool         `xml:"multiAttachEnabled"`
+	CreatedAt        Timestamp    `xml:"createTime"`
 	AttachmentSet    struct {
 		Items []EbsVolumeAttachementResponse `xml:"item"`
 	} `xml:"attachmentSet"`
@@ -53,9 +95,71 @@ type EbsVolume struct {
 	} `xml:"tagSet"`
 }
 
+// Age returns how long ago the volume was created.
+func (v *EbsVolume) Age() time.Duration {
+	return time.Since(v.CreatedAt.Time)
+}
+
+// Attachment returns the attachment of the volume to an instance, or nil if it isn't attached. Volumes
+// attached to several instances using multi-attach return their first attachment.
+func (v *EbsVolume) Attachment() *EbsVolumeAttachementResponse {
+	for i, att := range v.AttachmentSet.Items {
+		if att.Status != VolumeDetached {
+			return &v.AttachmentSet.Items[i]
+		}
+	}
+	return nil
+}
+
+// NeedsMigration reports whether the volume has to be migrated, e.g. using MigrateVolumeToAZ, to be attached
+// to instances in the availability zone.
+func (v *EbsVolume) NeedsMigration(targetAZ string) bool {
+	return v.AvailabilityZone != targetAZ
+}
+
+// CanReuseIn reports whether the volume can be attached to the instance in the availability zone as is, it
+// has to be in the zone and either available or already attached to the instance.
+func (v *EbsVolume) CanReuseIn(targetAZ, instanceId string) bool {
+	if v.NeedsMigration(targetAZ) {
+		return false
+	}
+	switch v.Status {
+	case VolumeAvailable:
+		return true
+	case VolumeInUse:
+		att := v.Attachment()
+		return att != nil && att.InstanceId == instanceId
+	}
+	return false
+}
+
+// Refresh updates the volume in place with its current state, e.g. the status and tags after creating it.
+func (v *EbsVolume) Refresh(sr SignedRequester) error {
+	vol, err := VolumeById(sr, v.Id)
+	if err != nil {
+		return err
+	}
+	*v = *vol
+	return nil
+}
+
+// SortVolumesByAge sorts the volumes oldest first, volumes created at the same time keep their order.
+func SortVolumesByAge(vols []EbsVolume) {
+	sort.SliceStable(vols, func(i, j int) bool {
+		return vols[i].CreatedAt.Before(vols[j].CreatedAt.Time)
+	})
+}
+
+// SortVolumesBySize sorts the volumes largest first, volumes of the same size keep their order.
+func SortVolumesBySize(vols []EbsVolume) {
+	sort.SliceStable(vols, func(i, j int) bool {
+		return vols[i].Size > vols[j].Size
+	})
+}
+
 type VolumeStatus string
 
-//  creating | available | in-use | deleting | deleted | error
+// creating | available | in-use | deleting | deleted | error
 var (
 	VolumeInUse     VolumeStatus = "in-use"
 	VolumeCreating  VolumeStatus = "creating"
@@ -69,10 +173,16 @@ func (v VolumeStatus) String() string {
 	return string(v)
 }
 
+// IsTerminal reports whether the volume will never leave the status, i.e. it's deleted or failed.
+func (v VolumeStatus) IsTerminal() bool {
+	return v == VolumeDeleted || v == VolumeError
+}
+
 type EbsVolumeSet struct {
 	VolumeSet struct {
 		Items []EbsVolume `xml:"item"`
 	} `xml:"volumeSet"`
+	NextToken string `xml:"nextToken"`
 }
 
 type SnapshotStatus string
@@ -87,250 +197,944 @@ func (s SnapshotStatus) String() string {
 	return string(s)
 }
 
+// IsTerminal reports whether the snapshot will never leave the status, i.e. it's completed or failed.
+func (s SnapshotStatus) IsTerminal() bool {
+	return s == SnapshotCompleted || s == SnapshotError
+}
+
 type EbsSnapshot struct {
 	Id          string         `xml:"snapshotId"`
 	VolumeId    string         `xml:"volumeId"`
 	Status      SnapshotStatus `xml:"status"`
+	StartTime   Timestamp      `xml:"startTime"`
 	Description string         `xml:"description"`
+	// StorageTier is either standard or archive.
+	StorageTier string `xml:"storageTier"`
+	TagSet      struct {
+		Items []TagItem `xml:"item"`
+	} `xml:"tagSet"`
 }
 
 type EbsSnapshotSet struct {
 	SnapshotSet struct {
 		Items []EbsSnapshot `xml:"item"`
 	} `xml:"snapshotSet"`
+	NextToken string `xml:"nextToken"`
 }
 
-// VolumesByTags will return list of volumes that matches the specified tags.
-func VolumesByTags(sr SignedRequester, tags []TagItem) ([]EbsVolume, error) {
+// VolumesByTags will return list of volumes that matches the specified tags, ErrNoTags without any.
+func VolumesByTags(sr SignedRequester, tags []TagItem, opts ...ListOption) ([]EbsVolume, error) {
+	if len(tags) == 0 {
+		return nil, ErrNoTags
+	}
+	return VolumesByFilter(sr, TagFilters(tags), opts...)
+}
+
+// VolumesByIdsAndTags will return the volumes among ids that are still tagged with all the tags, in a single
+// request, e.g. to reconcile a known set of volumes with the tags they are expected to have.
+func VolumesByIdsAndTags(sr SignedRequester, ids []string, tags []TagItem) ([]EbsVolume, error) {
+	if len(tags) == 0 {
+		return nil, ErrNoTags
+	}
+	return VolumesByIdsAndFilter(sr, ids, TagFilters(tags))
+}
+
+// AllVolumes will return every volume of the account, following pagination.
+func AllVolumes(sr SignedRequester, opts ...ListOption) ([]EbsVolume, error) {
+	return VolumesByFilter(sr, nil, opts...)
+}
+
+// VolumesByFilter will return all volumes matching the filters, following pagination.
+func VolumesByFilter(sr SignedRequester, filters []Filter, opts ...ListOption) ([]EbsVolume, error) {
+	return VolumesByIdsAndFilter(sr, nil, filters, opts...)
+}
+
+// VolumesByIdsAndFilter will return the volumes among ids that also match the filters, e.g. the given volumes
+// if they are tagged a certain way. Without ids every volume matching the filters is returned.
+func VolumesByIdsAndFilter(sr SignedRequester, ids []string, filters []Filter, opts ...ListOption) ([]EbsVolume, error) {
+	values := describeVolumesRequest(ids, filters)
+	// Amazon refuses MaxResults together with volume ids, which are answered in a single page anyway.
+	maxResults := 500
+	if len(ids) > 0 {
+		maxResults = 0
+	}
+	list := newListConfig(values, maxResults, opts)
+
+	var vols []EbsVolume
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set, err := decodeVolumes(sr, b)
+		if err != nil {
+			return "", err
+		}
+		vols = append(vols, set.VolumeSet.Items...)
+		return list.next(len(vols), set.NextToken), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vols[:list.truncate(len(vols))], nil
+}
+
+// ForEachVolume calls fn for every volume matching the filters, holding no more than a page of volumes in memory
+// at once, e.g. to process large fleets. It stops at the first error returned by fn or when the context is done,
+// returning that error.
+func ForEachVolume(ctx context.Context, sr SignedRequester, filters []Filter, fn func(EbsVolume) error, opts ...ListOption) error {
+	values := describeVolumesRequest(nil, filters)
+	list := newListConfig(values, 500, opts)
+
+	count := 0
+	return paginate(sr, values, func(b []byte) (string, error) {
+		set, err := decodeVolumes(sr, b)
+		if err != nil {
+			return "", err
+		}
+		for _, vol := range set.VolumeSet.Items {
+			if list.limit > 0 && count >= list.limit {
+				return "", nil
+			}
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			if err := fn(vol); err != nil {
+				return "", err
+			}
+			count++
+		}
+		return list.next(count, set.NextToken), ctx.Err()
+	})
+}
+
+// describeVolumesRequest builds a DescribeVolumes request for the volumes among ids matching the filters,
+// Amazon combines both with AND.
+func describeVolumesRequest(ids []string, filters []Filter) url.Values {
 	values := make(url.Values)
 	values.Add("Action", "DescribeVolumes")
+	for i, id := range ids {
+		values.Add(fmt.Sprintf("VolumeId.%d", i+1), id)
+	}
+	addFilters(values, filters)
+	return values
+}
 
-	for n, tag := range tags {
-		values.Add(fmt.Sprintf("Filter.%d.Name", n+1), "tag:"+tag.Key)
-		values.Add(fmt.Sprintf("Filter.%d.Value", n+1), tag.Value)
+// VolumeIdsByTags will return the ids of the volumes matching the tags. Only the ids are decoded from the
+// responses, which is considerably cheaper than VolumesByTags for large numbers of volumes.
+func VolumeIdsByTags(sr SignedRequester, tags []TagItem) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, ErrNoTags
 	}
+	values := describeVolumesRequest(nil, TagFilters(tags))
 
-	b, err := sr.SignedRequest(values)
+	var ids []string
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		page, token, err := decodeVolumeIds(b)
+		ids = append(ids, page...)
+		return token, err
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return ids, nil
+}
+
+// decodeVolumeIds extracts the volume ids and the next token of a DescribeVolumes response without
+// unmarshaling the volumes.
+func decodeVolumeIds(b []byte) ([]string, string, error) {
+	var ids []string
+	var token string
+	// path holds the names of the elements enclosing the current token.
+	var path []string
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return ids, token, nil
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			path = append(path, el.Name.Local)
+			switch {
+			case len(path) == 4 && path[1] == "volumeSet" && path[2] == "item" && path[3] == "volumeId":
+				var id string
+				if err := d.DecodeElement(&id, &el); err != nil {
+					return nil, "", err
+				}
+				ids = append(ids, id)
+				path = path[:len(path)-1]
+			case len(path) == 2 && path[1] == "nextToken":
+				if err := d.DecodeElement(&token, &el); err != nil {
+					return nil, "", err
+				}
+				path = path[:len(path)-1]
+			}
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		}
+	}
+}
+
+// decodeVolumes decodes a DescribeVolumes response like decode would, using decodeVolumeSet.
+func decodeVolumes(sr SignedRequester, b []byte) (*EbsVolumeSet, error) {
+	set, err := decodeVolumeSet(b)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := sr.(*awsClient); ok && c.strict {
+		return set, verifyElements(b, set)
+	}
+	return set, nil
+}
+
+// decodeVolumeSet is equivalent to unmarshaling the response into an EbsVolumeSet with encoding/xml, but
+// walks the raw tokens itself to avoid the cost of reflection and of verifying the nesting of the elements,
+// saving about 40% of the allocations for large responses. Fields added to EbsVolume need to be added here too.
+func decodeVolumeSet(b []byte) (*EbsVolumeSet, error) {
 	set := new(EbsVolumeSet)
-	if err := xml.Unmarshal(b, set); err != nil {
+	// path holds the names of the elements enclosing the current token and text their character data.
+	var path []string
+	var text []byte
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			return set, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			path = append(path, el.Name.Local)
+			text = text[:0]
+			if len(path) < 3 || path[1] != "volumeSet" || el.Name.Local != "item" {
+				continue
+			}
+			items := &set.VolumeSet.Items
+			switch {
+			case len(path) == 3:
+				*items = append(*items, EbsVolume{})
+			case len(path) == 5 && len(*items) > 0 && path[3] == "attachmentSet":
+				vol := &(*items)[len(*items)-1]
+				vol.AttachmentSet.Items = append(vol.AttachmentSet.Items, EbsVolumeAttachementResponse{})
+			case len(path) == 5 && len(*items) > 0 && path[3] == "tagSet":
+				vol := &(*items)[len(*items)-1]
+				vol.TagSet.Items = append(vol.TagSet.Items, TagItem{})
+			}
+		case xml.CharData:
+			text = append(text, el...)
+		case xml.EndElement:
+			if len(path) == 0 {
+				return nil, fmt.Errorf("Unexpected end element %s", el.Name.Local)
+			}
+			if err := setVolumeSetField(set, path, text); err != nil {
+				return nil, err
+			}
+			path = path[:len(path)-1]
+			text = text[:0]
+		}
+	}
+}
+
+// setVolumeSetField assigns the character data of the element at path to the field it corresponds to.
+func setVolumeSetField(set *EbsVolumeSet, path []string, text []byte) error {
+	if len(path) == 2 && path[1] == "nextToken" {
+		set.NextToken = string(text)
+		return nil
+	}
+	items := set.VolumeSet.Items
+	if len(path) < 4 || path[1] != "volumeSet" || path[2] != "item" || len(items) == 0 {
+		return nil
+	}
+	vol := &items[len(items)-1]
+
+	var err error
+	switch {
+	case len(path) == 4:
+		switch path[3] {
+		case "volumeId":
+			vol.Id = string(text)
+		case "availabilityZone":
+			vol.AvailabilityZone = string(text)
+		case "size":
+			vol.Size, err = parseUint(text)
+		case "volumeType":
+			vol.VolumeType = string(text)
+		case "iops":
+			vol.Iops, err = parseUint(text)
+		case "throughput":
+			vol.Throughput, err = parseUint(text)
+		case "status":
+			vol.Status = VolumeStatus(text)
+		case "encrypted":
+			vol.Encrypted, err = parseBool(text)
+		case "snapshotId":
+			vol.SnapshotId = string(text)
+		case "outpostArn":
+			vol.OutpostArn = string(text)
+		case "multiAttachEnabled":
+			vol.MultiAttach, err = parseBool(text)
+		case "createTime":
+			err = vol.CreatedAt.UnmarshalText(text)
+		}
+	case len(path) == 6 && path[3] == "attachmentSet" && path[4] == "item" && len(vol.AttachmentSet.Items) > 0:
+		att := &vol.AttachmentSet.Items[len(vol.AttachmentSet.Items)-1]
+		switch path[5] {
+		case "instanceId":
+			att.InstanceId = string(text)
+		case "volumeId":
+			att.VolumeId = string(text)
+		case "status":
+			att.Status = AttachementStatus(text)
+		case "device":
+			att.Device = string(text)
+		case "attachTime":
+			err = att.AttachTime.UnmarshalText(text)
+		}
+	case len(path) == 6 && path[3] == "tagSet" && path[4] == "item" && len(vol.TagSet.Items) > 0:
+		tag := &vol.TagSet.Items[len(vol.TagSet.Items)-1]
+		switch path[5] {
+		case "key":
+			tag.Key = string(text)
+		case "value":
+			tag.Value = string(text)
+		}
+	}
+	return err
+}
+
+// parseUint parses the text of an element like encoding/xml, empty elements are zero.
+func parseUint(text []byte) (uint, error) {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 0)
+	return uint(n), err
+}
+
+// parseBool parses the text of an element like encoding/xml, empty elements are false.
+func parseBool(text []byte) (bool, error) {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// VolumesBySnapshot will return the volumes created from the snapshot, e.g. to check that it's safe to delete.
+func VolumesBySnapshot(sr SignedRequester, snapshotId string) ([]EbsVolume, error) {
+	return VolumesByFilter(sr, []Filter{{"snapshot-id", []string{snapshotId}}})
+}
+
+// UnencryptedVolumes will return all volumes that are not encrypted.
+func UnencryptedVolumes(sr SignedRequester) ([]EbsVolume, error) {
+	return VolumesByFilter(sr, []Filter{{"encrypted", []string{"false"}}})
+}
+
+// UnattachedVolumes will return the available volumes created longer ago than olderThan, oldest first.
+func UnattachedVolumes(sr SignedRequester, olderThan time.Duration) ([]EbsVolume, error) {
+	vols, err := VolumesByFilter(sr, []Filter{{"status", []string{VolumeAvailable.String()}}})
+	if err != nil {
 		return nil, err
 	}
 
-	return set.VolumeSet.Items, nil
+	var stale []EbsVolume
+	for _, vol := range vols {
+		if vol.Age() > olderThan {
+			stale = append(stale, vol)
+		}
+	}
+	SortVolumesByAge(stale)
+	return stale, nil
+}
+
+// VolumesByAttachmentStatus will return all volumes having an attachment in the specified status, e.g. to find
+// volumes stuck attaching or detaching.
+func VolumesByAttachmentStatus(sr SignedRequester, status AttachementStatus) ([]EbsVolume, error) {
+	return VolumesByFilter(sr, []Filter{{"attachment.status", []string{status.String()}}})
 }
 
 // VolumeById will return the volume that matches the specified id.
 func VolumeById(sr SignedRequester, id string) (*EbsVolume, error) {
-	values := make(url.Values)
-	values.Add("Action", "DescribeVolumes")
-	values.Add("VolumeId.1", id)
+	values := describeVolumesRequest([]string{id}, nil)
 
 	b, err := sr.SignedRequest(values)
 	if err != nil {
 		return nil, err
 	}
 
-	set := new(EbsVolumeSet)
-	if err := xml.Unmarshal(b, set); err != nil {
+	set, err := decodeVolumes(sr, b)
+	if err != nil {
 		return nil, err
 	}
 
-	if len(set.VolumeSet.Items) != 1 {
-		return nil, errors.New("Could not find the specified volume")
+	if err := expectOne("volume", id, len(set.VolumeSet.Items)); err != nil {
+		return nil, err
 	}
 	return &set.VolumeSet.Items[0], nil
 }
 
+// VolumeByIdAllowDeleted returns the volume even while it's deleting or deleted, which Amazon keeps reporting for
+// a while after DeleteVolume. ErrNotFound is only returned once the volume is gone entirely.
+func VolumeByIdAllowDeleted(sr SignedRequester, id string) (*EbsVolume, error) {
+	vol, err := VolumeById(sr, id)
+	if ErrorCode(err) == "InvalidVolume.NotFound" {
+		return nil, ErrNotFound
+	}
+	return vol, err
+}
+
+// VolumeSpec describes a volume to create. The zero value of every field but AZ is a valid default.
+type VolumeSpec struct {
+	// Size in GiB, may be zero when creating from a snapshot.
+	Size uint
+	// VolumeType such as gp3 or io2, defaults to io1 when Iops is set, gp2 when SSD is set and standard otherwise.
+	VolumeType string
+	// Iops to provision, requires an SSD volume type.
+	Iops uint
+	SSD  bool
+	// Throughput in MiB/s, only for gp3.
+	Throughput uint
+	// AZ is the availability zone to create the volume in.
+	AZ         string
+	SnapshotId string
+	Tags       []TagItem
+	// Encrypted volumes use KmsKeyId, or the default EBS key of the account if empty.
+	Encrypted bool
+	KmsKeyId  string
+	// MultiAttach allows attaching the volume to several instances, only for io1 and io2.
+	MultiAttach bool
+	// ClientToken makes the request idempotent, retrying it with the same token won't create another volume.
+	ClientToken string
+	// OutpostArn creates the volume on an Outpost, which has to be in the region of AZ.
+	OutpostArn string
+}
+
+// volumeType returns the volume type to create.
+func (spec *VolumeSpec) volumeType() string {
+	switch {
+	case spec.VolumeType != "":
+		return spec.VolumeType
+	case spec.Iops > 0:
+		return "io1"
+	case spec.SSD:
+		return "gp2"
+	}
+	return "standard"
+}
+
 // CreateVolume creates a new volume using specified properties.
 func CreateVolume(sr SignedRequester, size uint, piops uint, ssd bool, az, snapshot string, tags []TagItem) (*EbsVolume, error) {
-	values := make(url.Values)
-	values.Add("Action", "CreateVolume")
-	values.Add("Size", strconv.Itoa(int(size)))
-	values.Add("AvailabilityZone", az)
+	return CreateVolumeSpec(sr, VolumeSpec{
+		Size:       size,
+		Iops:       piops,
+		SSD:        ssd,
+		AZ:         az,
+		SnapshotId: snapshot,
+		Tags:       tags,
+	})
+}
 
-	if snapshot != "" {
-		values.Add("SnapshotId", snapshot)
+// CreateVolumeSpec creates a new volume as described by the spec.
+func CreateVolumeSpec(sr SignedRequester, spec VolumeSpec) (*EbsVolume, error) {
+	volumeType := spec.volumeType()
+	switch {
+	case spec.Iops > 0 && spec.VolumeType == "" && !spec.SSD:
+		return nil, errors.New("Provisioned IOPS volumes are only available as SSD")
+	case spec.Iops > 0 && volumeType != "io1" && volumeType != "io2" && volumeType != "gp3":
+		return nil, fmt.Errorf("IOPS can only be provisioned for io1, io2 and gp3 volumes, not %s", volumeType)
+	case spec.Throughput > 0 && volumeType != "gp3":
+		return nil, fmt.Errorf("Throughput can only be provisioned for gp3 volumes, not %s", volumeType)
+	case spec.MultiAttach && volumeType != "io1" && volumeType != "io2":
+		return nil, fmt.Errorf("Multi-Attach is only available for io1 and io2 volumes, not %s", volumeType)
 	}
-	if piops > 0 {
-		if !ssd {
-			return nil, errors.New("Provisioned IOPS volumes are only available as SSD")
+
+	p := params{"AvailabilityZone": spec.AZ, "VolumeType": volumeType}
+	if spec.Size > 0 {
+		p.Set("Size", strconv.Itoa(int(spec.Size)))
+	}
+	if spec.SnapshotId != "" {
+		p.Set("SnapshotId", spec.SnapshotId)
+	}
+	if spec.Iops > 0 {
+		p.Set("Iops", strconv.Itoa(int(spec.Iops)))
+	}
+	if spec.Encrypted {
+		p.Set("Encrypted", "true")
+		if spec.KmsKeyId != "" {
+			p.Set("KmsKeyId", spec.KmsKeyId)
 		}
-		values.Add("VolumeType", "io1")
-		values.Add("Iops", strconv.Itoa(int(piops)))
-	} else if ssd {
-		values.Add("VolumeType", "gp2")
-	} else {
-		values.Add("VolumeType", "standard")
 	}
 
-	b, err := sr.SignedRequest(values)
-	if err != nil {
-		return nil, err
+	// The remaining options were introduced after apiVersion.
+	if spec.Throughput > 0 {
+		p.Set("Throughput", strconv.Itoa(int(spec.Throughput)))
+	}
+	if spec.MultiAttach {
+		p.Set("MultiAttachEnabled", "true")
+	}
+	if spec.ClientToken != "" {
+		p.Set("ClientToken", spec.ClientToken)
+	}
+	if spec.OutpostArn != "" {
+		if err := checkOutpostZone(spec.OutpostArn, spec.AZ); err != nil {
+			return nil, err
+		}
+		p.Set("OutpostArn", spec.OutpostArn)
+	}
+	if spec.Throughput > 0 || spec.MultiAttach || spec.ClientToken != "" || spec.OutpostArn != "" || spec.VolumeType != "" {
+		p.Set("Version", latestAPIVersion)
 	}
 
 	vol := new(EbsVolume)
-	if err := xml.Unmarshal(b, vol); err != nil {
+	if err := call(sr, "CreateVolume", p, vol); err != nil {
 		return nil, err
 	}
 
 	// Volume is created, but creating tags is a separate request
-	if len(tags) > 0 {
-		if err = TagResource(sr, vol.Id, tags); err != nil {
+	if len(spec.Tags) > 0 {
+		if err := TagResource(sr, vol.Id, spec.Tags); err != nil {
 			return nil, err
 		}
 	}
 	return vol, nil
 }
 
+// checkOutpostZone verifies that the outpost, arn:aws:outposts:region:account:outpost/id, is in the region of the zone.
+func checkOutpostZone(arn, az string) error {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "outposts" || !strings.HasPrefix(parts[5], "outpost/") {
+		return fmt.Errorf("Invalid Outpost ARN %s", arn)
+	}
+	if region := parts[3]; az == "" || strings.TrimRight(az, "abcdefghijklmnopqrstuvwxyz") != region {
+		return fmt.Errorf("Outpost %s in %s cannot host volumes in availability zone %s", arn, region, az)
+	}
+	return nil
+}
+
 func DeleteVolume(sr SignedRequester, id string) error {
-	values := make(url.Values)
-	values.Add("Action", "DeleteVolume")
-	values.Add("VolumeId", id)
+	return call(sr, "DeleteVolume", params{"VolumeId": id}, nil)
+}
 
-	if _, err := sr.SignedRequest(values); err != nil {
+// DeleteVolumeIdempotent deletes the volume like DeleteVolume but succeeds if it's already gone, e.g. when
+// retrying after a timeout. Volumes still attached keep failing with VolumeInUse since they are not deleted.
+func DeleteVolumeIdempotent(sr SignedRequester, id string) error {
+	if err := DeleteVolume(sr, id); ErrorCode(err) != "InvalidVolume.NotFound" {
 		return err
 	}
-
 	return nil
 }
 
 func TagResource(sr SignedRequester, id string, tags []TagItem) error {
-	values := make(url.Values)
-	values.Add("Action", "CreateTags")
-	values.Add("ResourceId.1", id)
-
+	p := params{"ResourceId.1": id}
 	for n, tag := range tags {
-		values.Add(fmt.Sprintf("Tag.%d.Key", n+1), tag.Key)
-		values.Add(fmt.Sprintf("Tag.%d.Value", n+1), tag.Value)
+		p.Set(fmt.Sprintf("Tag.%d.Key", n+1), tag.Key)
+		p.Set(fmt.Sprintf("Tag.%d.Value", n+1), tag.Value)
+	}
+
+	return call(sr, "CreateTags", p, nil)
+}
+
+// AttachOption modifies the behaviour of AttachVolume.
+type AttachOption func(*attachConfig)
+
+type attachConfig struct {
+	skipZoneCheck bool
+	device        string
+}
+
+// SkipZoneCheck disables verifying that the volume and instance share availability zone before attaching,
+// saving two requests when the caller already knows they do.
+func SkipZoneCheck() AttachOption {
+	return func(c *attachConfig) {
+		c.skipZoneCheck = true
+	}
+}
+
+// WithDevice attaches the volume on the specified device instead of the next free one, e.g. one handed
+// out by a DeviceAllocator.
+func WithDevice(device string) AttachOption {
+	return func(c *attachConfig) {
+		c.device = device
 	}
+}
 
-	if _, err := sr.SignedRequest(values); err != nil {
+// checkSameZone returns a descriptive error if the volume and instance are in different availability zones.
+func checkSameZone(sr SignedRequester, id, instance string) error {
+	vol, err := VolumeById(sr, id)
+	if err != nil {
+		return err
+	}
+	inst, err := InstanceById(sr, instance)
+	if err != nil {
 		return err
 	}
 
+	if az := inst.Placement.AvailabilityZone; vol.AvailabilityZone != az {
+		return fmt.Errorf("Volume %s in %s cannot attach to instance %s in %s", id, vol.AvailabilityZone, instance, az)
+	}
 	return nil
 }
 
-func AttachVolume(sr SignedRequester, id, instance string) (device string, err error) {
-	var mapping []DeviceMapping
-	mapping, err = GetBlockDeviceMapping(sr, instance)
+// AttachVolume attaches the volume to the instance on the next free device and returns the device name.
+func AttachVolume(sr SignedRequester, id, instance string, opts ...AttachOption) (string, error) {
+	device, _, err := attachVolume(sr, id, instance, opts)
+	return device, err
+}
+
+// AttachVolumeResult attaches the volume like AttachVolume, returning the attachment as reported by Amazon,
+// e.g. with the attaching status and the time of attachment.
+func AttachVolumeResult(sr SignedRequester, id, instance string, opts ...AttachOption) (*EbsVolumeAttachementResponse, error) {
+	_, att, err := attachVolume(sr, id, instance, opts)
+	return att, err
+}
+
+// AttachVolumeWithDeleteOnTermination attaches the volume like AttachVolume and sets whether it's deleted when
+// the instance terminates, e.g. for scratch volumes. Amazon only accepts the flag once the volume shows up in
+// the block device mapping of the instance, which is waited for, and the mapping is read back to confirm it.
+func AttachVolumeWithDeleteOnTermination(sr SignedRequester, id, instance string, deleteOnTermination bool) (string, error) {
+	device, err := AttachVolume(sr, id, instance)
 	if err != nil {
-		return
+		return device, err
 	}
 
-	device = "/dev/sdf"
-	for _, item := range mapping {
-		if !strings.HasPrefix(item.Device, "/dev/sd") {
-			continue
+	mapped := func() (*DeviceMapping, error) {
+		mappings, err := GetBlockDeviceMapping(sr, instance)
+		if err != nil {
+			return nil, err
 		}
-		// Put our device one step ahead of anyone else by naively shifting the last byte
-		if item.Device >= device {
-			b := []byte(item.Device)
-			device = string(append(b[:len(b)-1], b[len(b)-1]+1))
+		for i := range mappings {
+			if mappings[i].Device == device && mappings[i].Info.Id == id {
+				return &mappings[i], nil
+			}
 		}
+		return nil, nil
+	}
+	err = wait(context.Background(), sr, nil, func() (bool, error) {
+		m, err := mapped()
+		return m != nil, err
+	})
+	if err != nil {
+		return device, err
 	}
 
-	values := make(url.Values)
-	values.Add("Action", "AttachVolume")
-	values.Add("InstanceId", instance)
-	values.Add("VolumeId", id)
-	values.Add("Device", device)
+	p := params{
+		"InstanceId":                                   instance,
+		"BlockDeviceMapping.1.DeviceName":              device,
+		"BlockDeviceMapping.1.Ebs.VolumeId":            id,
+		"BlockDeviceMapping.1.Ebs.DeleteOnTermination": strconv.FormatBool(deleteOnTermination),
+	}
+	if err := call(sr, "ModifyInstanceAttribute", p, nil); err != nil {
+		return device, err
+	}
 
-	_, err = sr.SignedRequest(values)
-	return
+	m, err := mapped()
+	if err != nil {
+		return device, err
+	}
+	if m == nil || m.Info.DeleteOnTermination != deleteOnTermination {
+		return device, fmt.Errorf("DeleteOnTermination of %s on %s was not set to %t", id, device, deleteOnTermination)
+	}
+	return device, nil
 }
 
-func DetachVolume(sr SignedRequester, id string) (AttachementStatus, error) {
-	values := make(url.Values)
-	values.Add("Action", "DetachVolume")
-	values.Add("VolumeId", id)
+func attachVolume(sr SignedRequester, id, instance string, opts []AttachOption) (string, *EbsVolumeAttachementResponse, error) {
+	config := new(attachConfig)
+	for _, opt := range opts {
+		opt(config)
+	}
+	if !config.skipZoneCheck {
+		if err := checkSameZone(sr, id, instance); err != nil {
+			return "", nil, err
+		}
+	}
 
-	b, err := sr.SignedRequest(values)
+	device := config.device
+	if device == "" {
+		var err error
+		if device, err = NextFreeDevice(sr, instance); err != nil {
+			return "", nil, err
+		}
+	}
+
+	att := new(EbsVolumeAttachementResponse)
+	if err := call(sr, "AttachVolume", params{"InstanceId": instance, "VolumeId": id, "Device": device}, att); err != nil {
+		return device, nil, err
+	}
+	return device, att, nil
+}
+
+// NextFreeDevice returns the first device name from /dev/sdf to /dev/sdp, the range recommended for EBS
+// volumes, that is not already used by the instance.
+func NextFreeDevice(sr SignedRequester, instance string) (string, error) {
+	mapping, err := GetBlockDeviceMapping(sr, instance)
 	if err != nil {
-		return AttachementStatus(""), err
+		return "", err
 	}
 
-	volres := new(EbsVolumeAttachementResponse)
-	err = xml.Unmarshal(b, volres)
+	device := nextFreeDevice(mapping, nil)
+	if device == "" {
+		return "", fmt.Errorf("All device names from /dev/sdf to /dev/sdp are in use on %s", instance)
+	}
+	return device, nil
+}
 
-	return volres.Status, err
+// DeviceAllocator hands out distinct device names for an instance. It keeps track of the devices it has
+// handed out so that concurrent attachments to the same instance don't pick the same device.
+type DeviceAllocator struct {
+	sr       SignedRequester
+	instance string
+
+	mu       sync.Mutex
+	reserved map[string]bool
 }
 
-func GetBlockDeviceMapping(sr SignedRequester, instance string) ([]DeviceMapping, error) {
-	values := make(url.Values)
-	values.Add("Action", "DescribeInstanceAttribute")
-	values.Add("InstanceId", instance)
-	values.Add("Attribute", "blockDeviceMapping")
+// NewDeviceAllocator returns an allocator for devices on the specified instance, safe for concurrent use.
+func NewDeviceAllocator(sr SignedRequester, instance string) *DeviceAllocator {
+	return &DeviceAllocator{
+		sr:       sr,
+		instance: instance,
+		reserved: make(map[string]bool),
+	}
+}
 
-	b, err := sr.SignedRequest(values)
+// Next reserves and returns a device name that is neither used by the instance nor handed out before.
+func (a *DeviceAllocator) Next() (string, error) {
+	mapping, err := GetBlockDeviceMapping(a.sr, a.instance)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	device := nextFreeDevice(mapping, a.reserved)
+	if device == "" {
+		return "", fmt.Errorf("All device names from /dev/sdf to /dev/sdp are in use or reserved on %s", a.instance)
+	}
+	a.reserved[device] = true
+	return device, nil
+}
+
+// Release makes a device available again, e.g. after the attachment using it failed.
+func (a *DeviceAllocator) Release(device string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.reserved, device)
+}
+
+// nextFreeDevice returns the first device name neither in the mapping nor reserved, or empty string if none.
+func nextFreeDevice(mapping []DeviceMapping, reserved map[string]bool) string {
+	used := make(map[byte]bool)
+	for _, item := range mapping {
+		// The kernel may expose /dev/sdf as /dev/xvdf, both occupy the same slot.
+		for _, prefix := range []string{"/dev/sd", "/dev/xvd"} {
+			if strings.HasPrefix(item.Device, prefix) && len(item.Device) > len(prefix) {
+				used[item.Device[len(prefix)]] = true
+			}
+		}
+	}
+
+	for c := byte('f'); c <= 'p'; c++ {
+		if device := "/dev/sd" + string(c); !used[c] && !reserved[device] {
+			return device
+		}
+	}
+	return ""
+}
+
+func DetachVolume(sr SignedRequester, id string) (AttachementStatus, error) {
+	volres := new(EbsVolumeAttachementResponse)
+	err := call(sr, "DetachVolume", params{"VolumeId": id}, volres)
+
+	return volres.Status, err
+}
+
+func GetBlockDeviceMapping(sr SignedRequester, instance string) ([]DeviceMapping, error) {
 	m := &struct {
 		Mappings struct {
 			Item []DeviceMapping `xml:"item"`
 		} `xml:"blockDeviceMapping"`
 	}{}
-	if err := xml.Unmarshal(b, &m); err != nil {
+	if err := call(sr, "DescribeInstanceAttribute", params{"InstanceId": instance, "Attribute": "blockDeviceMapping"}, m); err != nil {
 		return nil, err
 	}
 
 	return m.Mappings.Item, nil
 }
 
-func CreateSnapshot(sr SignedRequester, volume, description string) (*EbsSnapshot, error) {
-	values := make(url.Values)
-	values.Add("Action", "CreateSnapshot")
-	values.Add("Description", description)
-	values.Add("VolumeId", volume)
+// BlockDeviceMappings returns the block device mappings of several instances using a single request,
+// keyed by instance id.
+func BlockDeviceMappings(sr SignedRequester, instanceIds []string) (map[string][]DeviceMapping, error) {
+	mappings := make(map[string][]DeviceMapping, len(instanceIds))
+	// Without any ids every instance would be described.
+	if len(instanceIds) == 0 {
+		return mappings, nil
+	}
 
-	b, err := sr.SignedRequest(values)
-	if err != nil {
+	p := make(params)
+	for n, id := range instanceIds {
+		p.Set(fmt.Sprintf("InstanceId.%d", n+1), id)
+	}
+
+	set := new(InstanceReservationSet)
+	if err := call(sr, "DescribeInstances", p, set); err != nil {
 		return nil, err
 	}
 
+	for _, instance := range set.Instances() {
+		mappings[instance.Id] = instance.BlockDeviceMapping.Items
+	}
+	return mappings, nil
+}
+
+func CreateSnapshot(sr SignedRequester, volume, description string) (*EbsSnapshot, error) {
+	return CreateSnapshotWithTags(sr, volume, description, nil)
+}
+
+// CreateSnapshotWithTags creates a snapshot of the volume tagged as part of the request, so that it can be
+// found by its tags right away. Endpoints that don't know tag specifications yet, e.g. emulators of older API
+// versions, are handled by tagging the snapshot once it was created.
+func CreateSnapshotWithTags(sr SignedRequester, volume, description string, tags []TagItem) (*EbsSnapshot, error) {
+	p := params{"Description": description, "VolumeId": volume}
+	if len(tags) > 0 {
+		p.Set("Version", latestAPIVersion)
+		addTagSpecification(p, "snapshot", tags)
+	}
+
 	snap := new(EbsSnapshot)
-	if err := xml.Unmarshal(b, snap); err != nil {
+	err := call(sr, "CreateSnapshot", p, snap)
+	if ErrorCode(err) == "UnknownParameter" && len(tags) > 0 {
+		snap = new(EbsSnapshot)
+		if err = call(sr, "CreateSnapshot", params{"Description": description, "VolumeId": volume}, snap); err == nil {
+			err = TagResource(sr, snap.Id, tags)
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
 
+	if len(snap.TagSet.Items) == 0 {
+		snap.TagSet.Items = tags
+	}
 	return snap, nil
 }
 
 func SnapshotById(sr SignedRequester, id string) (*EbsSnapshot, error) {
+	snapset := new(EbsSnapshotSet)
+	if err := call(sr, "DescribeSnapshots", params{"SnapshotId.1": id}, snapset); err != nil {
+		return nil, err
+	}
+
+	if err := expectOne("snapshot", id, len(snapset.SnapshotSet.Items)); err != nil {
+		return nil, err
+	}
+	return &snapset.SnapshotSet.Items[0], nil
+}
+
+// snapshotIdsPerRequest is the number of snapshot ids SnapshotsByIds describes at once, keeping the query
+// string of the requests reasonably short.
+const snapshotIdsPerRequest = 200
+
+// SnapshotsByIds will return the snapshots with the ids, e.g. to check the status of many snapshots being
+// created using one request per snapshotIdsPerRequest ids. Amazon fails the request with
+// InvalidSnapshot.NotFound if any of the snapshots doesn't exist.
+func SnapshotsByIds(sr SignedRequester, ids []string) ([]EbsSnapshot, error) {
+	var snaps []EbsSnapshot
+	for _, chunk := range chunkValues(ids, snapshotIdsPerRequest) {
+		p := make(params)
+		for n, id := range chunk {
+			p.Set(fmt.Sprintf("SnapshotId.%d", n+1), id)
+		}
+		snapset := new(EbsSnapshotSet)
+		if err := call(sr, "DescribeSnapshots", p, snapset); err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snapset.SnapshotSet.Items...)
+	}
+	return snaps, nil
+}
+
+// SnapshotsByFilter will return all snapshots owned by us matching the filters, following pagination.
+func SnapshotsByFilter(sr SignedRequester, filters []Filter, opts ...ListOption) ([]EbsSnapshot, error) {
 	values := make(url.Values)
 	values.Add("Action", "DescribeSnapshots")
-	values.Add("SnapshotId.1", id)
+	values.Add("Owner.1", "self")
+	addFilters(values, filters)
+	list := newListConfig(values, 1000, opts)
 
-	b, err := sr.SignedRequest(values)
+	var snaps []EbsSnapshot
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set := new(EbsSnapshotSet)
+		if err := decode(sr, b, set); err != nil {
+			return "", err
+		}
+		snaps = append(snaps, set.SnapshotSet.Items...)
+		return list.next(len(snaps), set.NextToken), nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	snapset := new(EbsSnapshotSet)
-	if err := xml.Unmarshal(b, snapset); err != nil {
-		return nil, err
-	}
+	return snaps[:list.truncate(len(snaps))], nil
+}
 
-	if len(snapset.SnapshotSet.Items) != 1 {
-		return nil, errors.New("Could not find the specified snapshot")
+// SnapshotsByTags will return the snapshots owned by us that matches the specified tags.
+func SnapshotsByTags(sr SignedRequester, tags []TagItem, opts ...ListOption) ([]EbsSnapshot, error) {
+	if len(tags) == 0 {
+		return nil, ErrNoTags
 	}
-	return &snapset.SnapshotSet.Items[0], nil
+	return SnapshotsByFilter(sr, TagFilters(tags), opts...)
+}
+
+// SnapshotsByStatus will return the snapshots owned by us in the specified status, e.g. pending ones to find
+// stuck backups.
+func SnapshotsByStatus(sr SignedRequester, status SnapshotStatus, opts ...ListOption) ([]EbsSnapshot, error) {
+	return SnapshotsByFilter(sr, []Filter{{"status", []string{string(status)}}}, opts...)
 }
 
 func DeleteSnapshot(sr SignedRequester, id string) error {
-	values := make(url.Values)
-	values.Add("Action", "DeleteSnapshot")
-	values.Add("SnapshotId", id)
+	return call(sr, "DeleteSnapshot", params{"SnapshotId": id}, nil)
+}
+
+// TagSnapshot adds the tags to the snapshot, e.g. to record the outcome of the operation it was made for so
+// that it can later be found using SnapshotsByTags.
+func TagSnapshot(sr SignedRequester, id string, tags []TagItem) error {
+	return TagResource(sr, id, tags)
+}
 
-	if _, err := sr.SignedRequest(values); err != nil {
+// CancelSnapshot aborts a snapshot that is still in progress by deleting it. Completed snapshots are left
+// alone and reported as an error, use DeleteSnapshot to remove them.
+func CancelSnapshot(sr SignedRequester, id string) error {
+	snap, err := SnapshotById(sr, id)
+	if err != nil {
 		return err
 	}
+	if snap.Status != SnapshotPending {
+		return fmt.Errorf("Snapshot %s is %s and can no longer be cancelled", id, snap.Status)
+	}
+	return DeleteSnapshot(sr, id)
+}
 
-	return nil
+// ArchiveSnapshot moves a completed snapshot to the archive tier, which is cheaper for long term retention.
+func ArchiveSnapshot(sr SignedRequester, id string) error {
+	return call(sr, "ModifySnapshotTier", params{"Version": latestAPIVersion, "SnapshotId": id, "StorageTier": "archive"}, nil)
+}
+
+// RestoreSnapshotTier restores an archived snapshot to the standard tier, either permanently or for the
+// specified number of days.
+func RestoreSnapshotTier(sr SignedRequester, id string, permanent bool, days int) error {
+	p := params{"Version": latestAPIVersion, "SnapshotId": id}
+	if permanent {
+		p.Set("PermanentRestore", "true")
+	} else {
+		p.Set("TemporaryRestoreDays", strconv.Itoa(days))
+	}
+
+	return call(sr, "RestoreSnapshotTier", p, nil)
 }
@@ -1,10 +1,18 @@
 package aws
 
 import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestVolumeByName(t *testing.T) {
@@ -68,6 +76,9 @@ func TestVolumeByName(t *testing.T) {
 	if vol[0].AvailabilityZone != "eu-west-1a" {
 		t.Error("Expected availability zone")
 	}
+	if vol[0].Size != 1 || vol[0].VolumeType != "standard" {
+		t.Error("Expected size and volume type, got", vol[0].Size, vol[0].VolumeType)
+	}
 	if len(vol[0].TagSet.Items) != 2 {
 		t.Error("Error expected correct amount of tags")
 	}
@@ -165,10 +176,143 @@ func TestCreateNewPiops(t *testing.T) {
 	}
 }
 
+func TestCreateVolumeSpec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		e := url.Values{
+			"Action":           {"CreateVolume"},
+			"Version":          {latestAPIVersion},
+			"AvailabilityZone": {"eu-west-1a"},
+			"VolumeType":       {"gp3"},
+			"Size":             {"100"},
+			"Iops":             {"4000"},
+			"Throughput":       {"250"},
+			"Encrypted":        {"true"},
+			"ClientToken":      {"550e8400-e29b-41d4-a716-446655440000"},
+		}
+		for key := range e {
+			if q.Get(key) != e.Get(key) {
+				t.Errorf("Expected %s to be %s, got %s", key, e.Get(key), q.Get(key))
+			}
+		}
+		if q.Get("SnapshotId") != "" || q.Get("KmsKeyId") != "" || q.Get("MultiAttachEnabled") != "" {
+			t.Error("Expected unset options to be left out, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <volumeId>vol-72d8f579</volumeId>
+    <size>100</size>
+    <volumeType>gp3</volumeType>
+    <status>creating</status>
+</CreateVolumeResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vol, err := CreateVolumeSpec(sr, VolumeSpec{
+		Size:        100,
+		VolumeType:  "gp3",
+		Iops:        4000,
+		Throughput:  250,
+		AZ:          "eu-west-1a",
+		Encrypted:   true,
+		ClientToken: "550e8400-e29b-41d4-a716-446655440000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.VolumeType != "gp3" || vol.Size != 100 {
+		t.Error("Unexpected volume", vol)
+	}
+
+	if _, err := CreateVolumeSpec(sr, VolumeSpec{Size: 100, Throughput: 250, SSD: true, AZ: "eu-west-1a"}); err == nil {
+		t.Error("Expected throughput to require gp3")
+	}
+	if _, err := CreateVolumeSpec(sr, VolumeSpec{Size: 100, MultiAttach: true, VolumeType: "gp3", AZ: "eu-west-1a"}); err == nil {
+		t.Error("Expected Multi-Attach to require io1 or io2")
+	}
+}
+
+func TestCreateVolumeOnOutpost(t *testing.T) {
+	arn := "arn:aws:outposts:eu-west-1:123456789012:outpost/op-1a2b3c4d5e6f7a8b9"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); q.Get("OutpostArn") != arn || q.Get("Version") != latestAPIVersion {
+			t.Error("Expected OutpostArn to be sent, got", q)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <volumeId>vol-72d8f579</volumeId>
+    <availabilityZone>eu-west-1a</availabilityZone>
+    <outpostArn>%s</outpostArn>
+    <status>creating</status>
+</CreateVolumeResponse>`, arn)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vol, err := CreateVolumeSpec(sr, VolumeSpec{Size: 10, SSD: true, AZ: "eu-west-1a", OutpostArn: arn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.OutpostArn != arn {
+		t.Error("Expected volume to be on the outpost, got", vol.OutpostArn)
+	}
+
+	if _, err := CreateVolumeSpec(sr, VolumeSpec{Size: 10, AZ: "us-east-1a", OutpostArn: arn}); err == nil {
+		t.Error("Expected outpost in another region to fail")
+	}
+	if _, err := CreateVolumeSpec(sr, VolumeSpec{Size: 10, AZ: "eu-west-1a", OutpostArn: "op-1a2b3c4d5e6f7a8b9"}); err == nil {
+		t.Error("Expected invalid ARN to fail")
+	}
+}
+
 func TestAttachVolume(t *testing.T) {
 	calls := []string{}
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		replies := map[string]string{
+			"DescribeVolumes": `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>8f0ea6b0-8a7c-40f1-bc41-cd2cf2d887d5</requestId>
+    <volumeSet>
+        <item>
+            <volumeId>vol-9d351996</volumeId>
+            <size>1</size>
+            <snapshotId/>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <status>available</status>
+            <createTime>2014-10-03T15:18:42.354Z</createTime>
+            <attachmentSet/>
+            <volumeType>standard</volumeType>
+            <encrypted>false</encrypted>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`,
+			"DescribeInstances": `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>fdcdcab1-ae5c-489e-9c33-4637c5dda355</requestId>
+    <reservationSet>
+        <item>
+            <reservationId>r-1a2b3c4d</reservationId>
+            <ownerId>243444709602</ownerId>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <instanceState>
+                        <code>16</code>
+                        <name>running</name>
+                    </instanceState>
+                    <placement>
+                        <availabilityZone>eu-west-1a</availabilityZone>
+                        <groupName/>
+                        <tenancy>default</tenancy>
+                    </placement>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`,
 			"DescribeInstanceAttribute": `<?xml version="1.0" encoding="UTF-8"?>
 <DescribeInstanceAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
     <requestId>8c79a02c-1918-47d6-80b5-bbc9b91d9030</requestId>
@@ -224,8 +368,197 @@ func TestAttachVolume(t *testing.T) {
 		t.Error("Expected path to be set correctly, got", path)
 	}
 
+	if len(calls) != 4 {
+		t.Error("Expected exactly 4 calls to be made")
+	}
+
+	calls = []string{}
+	if _, err := AttachVolume(sr, "vol-9d351996", "i-7ae3b239", SkipZoneCheck()); err != nil {
+		t.Error(err)
+	}
 	if len(calls) != 2 {
-		t.Error("Expected exactly 2 calls to be made")
+		t.Error("Expected zone check to be skipped, got calls", calls)
+	}
+}
+
+func TestAttachVolumeResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "AttachVolume" || q.Get("Device") != "/dev/sdh" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<AttachVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>5f98fb9c-3b4b-4974-ae19-0d8bb763e017</requestId>
+    <volumeId>vol-9d351996</volumeId>
+    <instanceId>i-7ae3b239</instanceId>
+    <device>/dev/sdh</device>
+    <status>attaching</status>
+    <attachTime>2014-10-04T19:40:53.927Z</attachTime>
+</AttachVolumeResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	att, err := AttachVolumeResult(sr, "vol-9d351996", "i-7ae3b239", SkipZoneCheck(), WithDevice("/dev/sdh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if att.VolumeId != "vol-9d351996" || att.InstanceId != "i-7ae3b239" || att.Device != "/dev/sdh" || att.Status != "attaching" {
+		t.Error("Unexpected attachment", att)
+	}
+	if e := time.Date(2014, 10, 4, 19, 40, 53, 927000000, time.UTC); !att.AttachTime.Equal(e) {
+		t.Error("Expected the attach time to be parsed, got", att.AttachTime)
+	}
+}
+
+func TestAttachVolumeWithDeleteOnTermination(t *testing.T) {
+	var device, deleteOnTermination string
+	attached, modified := false, false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeVolumes":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-9d351996</volumeId>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <status>available</status>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+		case "DescribeInstances":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <placement>
+                        <availabilityZone>eu-west-1a</availabilityZone>
+                    </placement>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`)
+		case "AttachVolume":
+			device = q.Get("Device")
+			deleteOnTermination = "false"
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<AttachVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeId>vol-9d351996</volumeId>
+    <instanceId>i-7ae3b239</instanceId>
+    <device>%s</device>
+    <status>attaching</status>
+</AttachVolumeResponse>`, device)
+		case "DescribeInstanceAttribute":
+			mapping := ""
+			// The volume only shows up in the mapping on the second poll.
+			if device != "" && attached {
+				mapping = fmt.Sprintf(`<item>
+            <deviceName>%s</deviceName>
+            <ebs>
+                <volumeId>vol-9d351996</volumeId>
+                <status>attached</status>
+                <deleteOnTermination>%s</deleteOnTermination>
+            </ebs>
+        </item>`, device, deleteOnTermination)
+			}
+			attached = device != ""
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstanceAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <instanceId>i-7ae3b239</instanceId>
+    <blockDeviceMapping>
+        <item>
+            <deviceName>/dev/xvda</deviceName>
+            <ebs>
+                <volumeId>vol-38634e33</volumeId>
+                <status>attached</status>
+                <deleteOnTermination>true</deleteOnTermination>
+            </ebs>
+        </item>
+        %s
+    </blockDeviceMapping>
+</DescribeInstanceAttributeResponse>`, mapping)
+		case "ModifyInstanceAttribute":
+			if !attached || q.Get("InstanceId") != "i-7ae3b239" || q.Get("BlockDeviceMapping.1.DeviceName") != device ||
+				q.Get("BlockDeviceMapping.1.Ebs.VolumeId") != "vol-9d351996" {
+				t.Error("Unexpected request", q)
+			}
+			modified = true
+			deleteOnTermination = q.Get("BlockDeviceMapping.1.Ebs.DeleteOnTermination")
+			fmt.Fprint(w, `<ModifyInstanceAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</ModifyInstanceAttributeResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+
+	path, err := AttachVolumeWithDeleteOnTermination(sr, "vol-9d351996", "i-7ae3b239", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path == "" || path != device {
+		t.Errorf("Expected the device %s, got %s", device, path)
+	}
+	if !modified || deleteOnTermination != "true" {
+		t.Error("Expected DeleteOnTermination to be set, got", deleteOnTermination)
+	}
+}
+
+func TestAttachVolumeZoneMismatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch action := r.URL.Query().Get("Action"); action {
+		case "DescribeVolumes":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-9d351996</volumeId>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <status>available</status>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+		case "DescribeInstances":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <placement>
+                        <availabilityZone>eu-west-1b</availabilityZone>
+                    </placement>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	_, err := AttachVolume(sr, "vol-9d351996", "i-7ae3b239")
+	if err == nil {
+		t.Fatal("Expected an error when zones differ")
+	}
+	if e := "Volume vol-9d351996 in eu-west-1a cannot attach to instance i-7ae3b239 in eu-west-1b"; err.Error() != e {
+		t.Error("Unexpected error", err)
 	}
 }
 
@@ -292,6 +625,56 @@ func TestCreateSnapshot(t *testing.T) {
 	}
 }
 
+func TestCreateSnapshotWithTags(t *testing.T) {
+	supported := true
+	var tagged []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "CreateSnapshot":
+			if q.Get("TagSpecification.1.ResourceType") != "" && !supported {
+				w.WriteHeader(400)
+				fmt.Fprint(w, `<Response><Errors><Error><Code>UnknownParameter</Code><Message>The parameter TagSpecification is not recognized</Message></Error></Errors></Response>`)
+				return
+			}
+			if supported && (q.Get("Version") != latestAPIVersion || q.Get("TagSpecification.1.ResourceType") != "snapshot" ||
+				q.Get("TagSpecification.1.Tag.1.Key") != "Name" || q.Get("TagSpecification.1.Tag.1.Value") != "migration") {
+				t.Error("Expected a tag specification, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateSnapshotResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <snapshotId>snap-1db38de7</snapshotId>
+    <volumeId>vol-72d8f579</volumeId>
+    <status>pending</status>
+</CreateSnapshotResponse>`)
+		case "CreateTags":
+			tagged = append(tagged, q.Get("ResourceId.1")+" "+q.Get("Tag.1.Value"))
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	tags := []TagItem{{"Name", "migration"}}
+
+	snap, err := CreateSnapshotWithTags(sr, "vol-72d8f579", "testing", tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Id != "snap-1db38de7" || len(snap.TagSet.Items) != 1 || len(tagged) != 0 {
+		t.Error("Expected the snapshot to be tagged on creation, got", snap, tagged)
+	}
+
+	supported = false
+	if snap, err = CreateSnapshotWithTags(sr, "vol-72d8f579", "testing", tags); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tagged) != "[snap-1db38de7 migration]" || len(snap.TagSet.Items) != 1 {
+		t.Error("Expected the snapshot to be tagged afterwards, got", tagged)
+	}
+}
+
 func TestGetSnapshotById(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if a := "DescribeSnapshots"; r.URL.Query().Get("Action") != a {
@@ -327,3 +710,1147 @@ func TestGetSnapshotById(t *testing.T) {
 		t.Error("Expected snapshot status to be", SnapshotCompleted)
 	}
 }
+
+func TestTagSnapshot(t *testing.T) {
+	var tags []TagItem
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "CreateTags":
+			if q.Get("ResourceId.1") != "snap-1db38de7" {
+				t.Error("Expected snapshot to be tagged, got", q)
+			}
+			tags = append(tags, TagItem{q.Get("Tag.1.Key"), q.Get("Tag.1.Value")})
+		case "DescribeSnapshots":
+			if q.Get("Filter.1.Name") != "tag:Migration" || q.Get("Filter.1.Value.1") != "succeeded" {
+				t.Error("Expected tag filter, got", q)
+			}
+			var items string
+			for _, tag := range tags {
+				items += fmt.Sprintf("<item><key>%s</key><value>%s</value></item>", tag.Key, tag.Value)
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>
+        <item>
+            <snapshotId>snap-1db38de7</snapshotId>
+            <status>completed</status>
+            <tagSet>%s</tagSet>
+        </item>
+    </snapshotSet>
+</DescribeSnapshotsResponse>`, items)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := TagSnapshot(sr, "snap-1db38de7", []TagItem{{"Migration", "succeeded"}}); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := SnapshotsByTags(sr, []TagItem{{"Migration", "succeeded"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || len(snaps[0].TagSet.Items) != 1 || snaps[0].TagSet.Items[0].Value != "succeeded" {
+		t.Error("Expected the tagged snapshot, got", snaps)
+	}
+}
+
+func TestDeleteVolumeIdempotent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DeleteVolume" {
+			t.Error("Unexpected request", q)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		switch id := q.Get("VolumeId"); id {
+		case "vol-attached":
+			fmt.Fprintf(w, `<Response><Errors><Error><Code>VolumeInUse</Code><Message>Volume %s is currently attached to i-7ae3b239</Message></Error></Errors></Response>`, id)
+		default:
+			fmt.Fprintf(w, `<Response><Errors><Error><Code>InvalidVolume.NotFound</Code><Message>The volume '%s' does not exist.</Message></Error></Errors></Response>`, id)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := DeleteVolume(sr, "vol-72d8f579"); ErrorCode(err) != "InvalidVolume.NotFound" {
+		t.Error("Expected DeleteVolume to report the volume missing, got", err)
+	}
+	if err := DeleteVolumeIdempotent(sr, "vol-72d8f579"); err != nil {
+		t.Error("Expected a volume already gone to count as deleted, got", err)
+	}
+	if err := DeleteVolumeIdempotent(sr, "vol-attached"); ErrorCode(err) != "VolumeInUse" {
+		t.Error("Expected an attached volume to fail, got", err)
+	}
+}
+
+func TestAttachementStatusTransitions(t *testing.T) {
+	legal := [][2]AttachementStatus{
+		{VolumeAttaching, VolumeAttached},
+		{VolumeAttaching, VolumeDetached},
+		{VolumeAttached, VolumeDetaching},
+		{VolumeAttached, VolumeDetached},
+		{VolumeAttached, VolumeBusy},
+		{VolumeBusy, VolumeDetached},
+		{VolumeDetaching, VolumeBusy},
+		{VolumeDetaching, VolumeDetached},
+		{VolumeDetached, VolumeAttaching},
+		{VolumeDetached, VolumeAttached},
+		{VolumeAttached, VolumeAttached},
+	}
+	for _, tr := range legal {
+		if !tr[0].CanTransitionTo(tr[1]) {
+			t.Errorf("Expected %s to %s to be legal", tr[0], tr[1])
+		}
+	}
+
+	illegal := [][2]AttachementStatus{
+		{VolumeAttached, VolumeAttaching},
+		{VolumeBusy, VolumeAttaching},
+		{VolumeDetaching, VolumeAttached},
+		{VolumeDetached, VolumeDetaching},
+		{AttachementStatus("unknown"), VolumeAttached},
+	}
+	for _, tr := range illegal {
+		if tr[0].CanTransitionTo(tr[1]) {
+			t.Errorf("Expected %s to %s to be illegal", tr[0], tr[1])
+		}
+	}
+}
+
+func TestStatusIsTerminal(t *testing.T) {
+	for status, e := range map[VolumeStatus]bool{
+		VolumeCreating: false, VolumeAvailable: false, VolumeInUse: false,
+		VolumeDeleting: false, VolumeDeleted: true, VolumeError: true,
+	} {
+		if status.IsTerminal() != e {
+			t.Errorf("Expected IsTerminal of %s to be %t", status, e)
+		}
+	}
+	for status, e := range map[SnapshotStatus]bool{SnapshotPending: false, SnapshotCompleted: true, SnapshotError: true} {
+		if status.IsTerminal() != e {
+			t.Errorf("Expected IsTerminal of %s to be %t", status, e)
+		}
+	}
+}
+
+func TestSnapshotsByIds(t *testing.T) {
+	var requests [][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeSnapshots" || q.Get("Owner.1") != "" || q.Get("MaxResults") != "" {
+			t.Error("Unexpected request", q)
+		}
+		var ids []string
+		for n := 1; q.Get(fmt.Sprintf("SnapshotId.%d", n)) != ""; n++ {
+			ids = append(ids, q.Get(fmt.Sprintf("SnapshotId.%d", n)))
+		}
+		requests = append(requests, ids)
+
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>`)
+		for _, id := range ids {
+			fmt.Fprintf(w, `
+        <item>
+            <snapshotId>%s</snapshotId>
+            <volumeId>vol-1a2b3c4d</volumeId>
+            <status>completed</status>
+        </item>`, id)
+		}
+		fmt.Fprint(w, `
+    </snapshotSet>
+</DescribeSnapshotsResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, StrictDecoding())
+
+	snaps, err := SnapshotsByIds(sr, []string{"snap-1a2b3c4d", "snap-5e6f7a8b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || fmt.Sprint(requests[0]) != "[snap-1a2b3c4d snap-5e6f7a8b]" {
+		t.Error("Expected both ids in a single request, got", requests)
+	}
+	if len(snaps) != 2 || snaps[1].Id != "snap-5e6f7a8b" || snaps[1].Status != SnapshotCompleted {
+		t.Error("Unexpected snapshots", snaps)
+	}
+
+	requests = nil
+	ids := make([]string, snapshotIdsPerRequest+1)
+	for n := range ids {
+		ids[n] = fmt.Sprintf("snap-%08x", n)
+	}
+	if snaps, err := SnapshotsByIds(sr, ids); err != nil || len(snaps) != len(ids) {
+		t.Fatal("Expected every snapshot, got", len(snaps), err)
+	}
+	if len(requests) != 2 || len(requests[0]) != snapshotIdsPerRequest || requests[1][0] != ids[snapshotIdsPerRequest] {
+		t.Error("Expected the ids to be split in two requests, got", len(requests))
+	}
+
+	requests = nil
+	if snaps, err := SnapshotsByIds(sr, nil); err != nil || len(snaps) != 0 || len(requests) != 0 {
+		t.Error("Expected no request without ids, got", snaps, err)
+	}
+}
+
+func TestSnapshotsByStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeSnapshots" || q.Get("Owner.1") != "self" ||
+			q.Get("Filter.1.Name") != "status" || q.Get("Filter.1.Value.1") != "pending" || q.Get("Filter.2.Name") != "" {
+			t.Error("Expected a status filter on our snapshots, got", q)
+		}
+		next := "<nextToken>page2</nextToken>"
+		id := "snap-1db38de7"
+		if q.Get("NextToken") == "page2" {
+			next, id = "", "snap-72d8f579"
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>
+        <item>
+            <snapshotId>%s</snapshotId>
+            <status>pending</status>
+        </item>
+    </snapshotSet>
+    %s
+</DescribeSnapshotsResponse>`, id, next)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	snaps, err := SnapshotsByStatus(sr, SnapshotPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[1].Id != "snap-72d8f579" || snaps[1].Status != SnapshotPending {
+		t.Error("Expected the pending snapshots of both pages, got", snaps)
+	}
+}
+
+func TestCancelSnapshot(t *testing.T) {
+	status, deleted := "pending", false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch action := r.URL.Query().Get("Action"); action {
+		case "DescribeSnapshots":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>
+        <item>
+            <snapshotId>snap-1db38de7</snapshotId>
+            <status>%s</status>
+        </item>
+    </snapshotSet>
+</DescribeSnapshotsResponse>`, status)
+		case "DeleteSnapshot":
+			deleted = true
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := CancelSnapshot(sr, "snap-1db38de7"); err != nil {
+		t.Error(err)
+	}
+	if !deleted {
+		t.Error("Expected pending snapshot to be deleted")
+	}
+
+	status, deleted = "completed", false
+	if err := CancelSnapshot(sr, "snap-1db38de7"); err == nil {
+		t.Error("Expected completed snapshot not to be cancellable")
+	}
+	if deleted {
+		t.Error("Expected completed snapshot to be kept")
+	}
+}
+
+func TestNextFreeDevice(t *testing.T) {
+	mapping := []DeviceMapping{{Device: "/dev/xvda"}, {Device: "/dev/sdf"}, {Device: "/dev/xvdg"}}
+	if device := nextFreeDevice(mapping, nil); device != "/dev/sdh" {
+		t.Error("Expected /dev/sdh to be the next free device, got", device)
+	}
+
+	mapping = nil
+	for c := 'f'; c <= 'p'; c++ {
+		mapping = append(mapping, DeviceMapping{Device: "/dev/sd" + string(c)})
+	}
+	if device := nextFreeDevice(mapping, nil); device != "" {
+		t.Error("Expected no free device, got", device)
+	}
+}
+
+func TestBlockDeviceMappings(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeInstances" || q.Get("InstanceId.1") != "i-7ae3b239" || q.Get("InstanceId.2") != "i-1a2b3c4d" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <blockDeviceMapping>
+                        <item>
+                            <deviceName>/dev/sda1</deviceName>
+                            <ebs>
+                                <volumeId>vol-1a2b3c4d</volumeId>
+                                <status>attached</status>
+                                <attachTime>2014-10-06T11:43:23.000Z</attachTime>
+                                <deleteOnTermination>true</deleteOnTermination>
+                            </ebs>
+                        </item>
+                        <item>
+                            <deviceName>/dev/sdf</deviceName>
+                            <ebs>
+                                <volumeId>vol-9d13337</volumeId>
+                                <status>attached</status>
+                            </ebs>
+                        </item>
+                    </blockDeviceMapping>
+                </item>
+            </instancesSet>
+        </item>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-1a2b3c4d</instanceId>
+                    <blockDeviceMapping/>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	mappings, err := BlockDeviceMappings(sr, []string{"i-7ae3b239", "i-1a2b3c4d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 2 {
+		t.Fatal("Expected mappings for two instances, got", mappings)
+	}
+	if m := mappings["i-7ae3b239"]; len(m) != 2 || m[1].Device != "/dev/sdf" || m[1].Info.Id != "vol-9d13337" {
+		t.Error("Unexpected mapping", m)
+	}
+	if m := mappings["i-1a2b3c4d"]; len(m) != 0 {
+		t.Error("Expected no devices, got", m)
+	}
+}
+
+func TestDeviceAllocator(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a := "DescribeInstanceAttribute"; r.URL.Query().Get("Action") != a {
+			t.Errorf("Expected Action to be %s", a)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstanceAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <instanceId>i-7ae3b239</instanceId>
+    <blockDeviceMapping>
+        <item>
+            <deviceName>/dev/sdf</deviceName>
+            <ebs>
+                <volumeId>vol-9d13337</volumeId>
+                <status>attached</status>
+            </ebs>
+        </item>
+    </blockDeviceMapping>
+</DescribeInstanceAttributeResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	alloc := NewDeviceAllocator(sr, "i-7ae3b239")
+
+	var wg sync.WaitGroup
+	devices := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			device, err := alloc.Next()
+			if err != nil {
+				t.Error(err)
+			}
+			devices <- device
+		}()
+	}
+	wg.Wait()
+	close(devices)
+
+	seen := make(map[string]bool)
+	for device := range devices {
+		if seen[device] || device == "/dev/sdf" {
+			t.Error("Device handed out when already in use", device)
+		}
+		seen[device] = true
+	}
+
+	alloc.Release("/dev/sdg")
+	if device, err := alloc.Next(); err != nil || device != "/dev/sdg" {
+		t.Error("Expected released device to be handed out again, got", device, err)
+	}
+}
+
+func TestUnencryptedVolumes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if a := "DescribeVolumes"; q.Get("Action") != a {
+			t.Errorf("Expected Action to be %s", a)
+		}
+		if q.Get("Filter.1.Name") != "encrypted" || q.Get("Filter.1.Value.1") != "false" {
+			t.Error("Expected encrypted=false filter, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <status>available</status>
+            <encrypted>false</encrypted>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vols, err := UnencryptedVolumes(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 1 || vols[0].Encrypted {
+		t.Error("Expected one unencrypted volume, got", vols)
+	}
+}
+
+func TestVolumesByAttachmentStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Filter.1.Name") != "attachment.status" || q.Get("Filter.1.Value.1") != "detaching" {
+			t.Error("Expected attachment.status=detaching filter, got", q)
+		}
+		id, next := "vol-72d8f579", "<nextToken>page2</nextToken>"
+		if q.Get("NextToken") == "page2" {
+			id, next = "vol-842b078f", ""
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>%s</volumeId>
+            <status>in-use</status>
+            <attachmentSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <status>detaching</status>
+                </item>
+            </attachmentSet>
+        </item>
+    </volumeSet>
+    %s
+</DescribeVolumesResponse>`, id, next)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vols, err := VolumesByAttachmentStatus(sr, VolumeDetaching)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 2 || vols[1].Id != "vol-842b078f" || vols[0].AttachmentSet.Items[0].Status != VolumeDetaching {
+		t.Error("Expected two detaching volumes, got", vols)
+	}
+}
+
+func TestVolumesByFilterLimit(t *testing.T) {
+	pages := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		if m := r.URL.Query().Get("MaxResults"); m != "5" {
+			t.Error("Expected MaxResults to be 5, got", m)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item><volumeId>vol-72d8f579</volumeId></item>
+        <item><volumeId>vol-842b078f</volumeId></item>
+        <item><volumeId>vol-9d13337</volumeId></item>
+    </volumeSet>
+    <nextToken>page2</nextToken>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vols, err := VolumesByTags(sr, []TagItem{{"Name", "data"}}, Limit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 2 || vols[1].Id != "vol-842b078f" {
+		t.Error("Expected the first two volumes, got", vols)
+	}
+	if pages != 1 {
+		t.Error("Expected to stop after the first page, requested", pages)
+	}
+}
+
+func TestVolumesByFilterPageSize(t *testing.T) {
+	expected := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if m := q.Get("MaxResults"); m != expected {
+			t.Errorf("Expected MaxResults to be %s, got %s", expected, m)
+		}
+		next := ""
+		switch q.Get("NextToken") {
+		case "":
+			next = "<nextToken>page2</nextToken>"
+		case "page2":
+			next = "<nextToken>page3</nextToken>"
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item><volumeId>vol-%s</volumeId></item>
+    </volumeSet>
+    %s
+</DescribeVolumesResponse>`, q.Get("NextToken"), next)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	for size, m := range map[int]string{0: "500", 2: "5", 100: "100", 5000: "500"} {
+		expected = m
+		var opts []ListOption
+		if size > 0 {
+			opts = append(opts, PageSize(size))
+		}
+		vols, err := VolumesByFilter(sr, nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vols) != 3 || vols[2].Id != "vol-page3" {
+			t.Error("Expected the volumes of all pages, got", vols)
+		}
+	}
+}
+
+func TestVolumesByIdsAndFilter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("VolumeId.1") != "vol-72d8f579" || q.Get("VolumeId.2") != "vol-842b078f" {
+			t.Error("Expected both volume ids, got", q)
+		}
+		if q.Get("Filter.1.Name") != "tag:Name" || q.Get("Filter.1.Value.1") != "data" {
+			t.Error("Expected tag filter, got", q)
+		}
+		if m := q.Get("MaxResults"); m != "" {
+			t.Error("Expected no MaxResults together with volume ids, got", m)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item><volumeId>vol-842b078f</volumeId></item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vols, err := VolumesByIdsAndFilter(sr, []string{"vol-72d8f579", "vol-842b078f"}, TagFilters([]TagItem{{"Name", "data"}}), Limit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 1 || vols[0].Id != "vol-842b078f" {
+		t.Error("Expected only the tagged volume, got", vols)
+	}
+}
+
+func TestVolumesByIdsAndTags(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeVolumes" || q.Get("VolumeId.1") != "vol-72d8f579" || q.Get("VolumeId.2") != "vol-842b078f" {
+			t.Error("Expected both volume ids, got", q)
+		}
+		if q.Get("Filter.1.Name") != "tag:role" || q.Get("Filter.1.Value.1") != "db" ||
+			q.Get("Filter.2.Name") != "tag:env" || q.Get("Filter.2.Value.1") != "prod" {
+			t.Error("Expected both tag filters, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item><volumeId>vol-72d8f579</volumeId></item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vols, err := VolumesByIdsAndTags(sr, []string{"vol-72d8f579", "vol-842b078f"}, []TagItem{{"role", "db"}, {"env", "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 1 || vols[0].Id != "vol-72d8f579" {
+		t.Error("Expected only the volume still tagged, got", vols)
+	}
+	if requests != 1 {
+		t.Error("Expected a single request, got", requests)
+	}
+}
+
+func TestVolumesByTagsWithoutTags(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if q := r.URL.Query(); q.Get("Filter.1.Name") != "" {
+			t.Error("Expected no filters, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item><volumeId>vol-72d8f579</volumeId></item>
+        <item><volumeId>vol-842b078f</volumeId></item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if _, err := VolumesByTags(sr, nil); err != ErrNoTags {
+		t.Error("Expected ErrNoTags, got", err)
+	}
+	if _, err := VolumeIdsByTags(sr, []TagItem{}); err != ErrNoTags {
+		t.Error("Expected ErrNoTags, got", err)
+	}
+	if _, err := VolumesByIdsAndTags(sr, nil, nil); err != ErrNoTags {
+		t.Error("Expected ErrNoTags, got", err)
+	}
+	if requests != 0 {
+		t.Error("Expected no request without tags, got", requests)
+	}
+
+	vols, err := AllVolumes(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 2 || requests != 1 {
+		t.Error("Expected every volume, got", vols)
+	}
+}
+
+func TestUnattachedVolumes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Filter.1.Name") != "status" || q.Get("Filter.1.Value.1") != "available" {
+			t.Error("Expected status=available filter, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <status>available</status>
+            <createTime>2014-10-03T15:18:42.354Z</createTime>
+        </item>
+        <item>
+            <volumeId>vol-842b078f</volumeId>
+            <status>available</status>
+            <createTime>2099-10-04T16:30:35.740Z</createTime>
+        </item>
+        <item>
+            <volumeId>vol-9d351996</volumeId>
+            <status>available</status>
+            <createTime>2014-09-01T08:00:00.000Z</createTime>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vols, err := UnattachedVolumes(sr, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 2 {
+		t.Fatal("Expected the two old volumes, got", vols)
+	}
+	if vols[0].Id != "vol-9d351996" || vols[1].Id != "vol-72d8f579" {
+		t.Error("Expected volumes sorted oldest first, got", vols[0].Id, vols[1].Id)
+	}
+}
+
+func TestVolumeByIdCount(t *testing.T) {
+	items := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>%s</volumeSet>
+</DescribeVolumesResponse>`, items)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if _, err := VolumeById(sr, "vol-72d8f579"); err != ErrNotFound {
+		t.Error("Expected ErrNotFound, got", err)
+	}
+
+	items = "<item><volumeId>vol-72d8f579</volumeId></item><item><volumeId>vol-72d8f579</volumeId></item>"
+	_, err := VolumeById(sr, "vol-72d8f579")
+	if e, ok := err.(*AmbiguousError); !ok || e.Count != 2 {
+		t.Error("Expected AmbiguousError with count 2, got", err)
+	}
+}
+
+func TestSnapshotTier(t *testing.T) {
+	params := make(map[string]url.Values)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		params[q.Get("Action")] = q
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ModifySnapshotTierResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>c9d2e8a6-1d9f-4b8e-8b0d-EXAMPLE</requestId>
+    <snapshotId>snap-1db38de7</snapshotId>
+</ModifySnapshotTierResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := ArchiveSnapshot(sr, "snap-1db38de7"); err != nil {
+		t.Error(err)
+	}
+	if q := params["ModifySnapshotTier"]; q.Get("StorageTier") != "archive" || q.Get("Version") != "2016-11-15" {
+		t.Error("Unexpected ModifySnapshotTier params", q)
+	}
+
+	if err := RestoreSnapshotTier(sr, "snap-1db38de7", false, 7); err != nil {
+		t.Error(err)
+	}
+	if q := params["RestoreSnapshotTier"]; q.Get("TemporaryRestoreDays") != "7" || q.Get("PermanentRestore") != "" {
+		t.Error("Unexpected RestoreSnapshotTier params", q)
+	}
+}
+
+func TestVolumeIdsByTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, next := "vol-72d8f579", "<nextToken>page2</nextToken>"
+		if r.URL.Query().Get("NextToken") == "page2" {
+			id, next = "vol-842b078f", ""
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>%s</volumeId>
+            <attachmentSet>
+                <item>
+                    <volumeId>%s</volumeId>
+                    <instanceId>i-7ae3b239</instanceId>
+                </item>
+            </attachmentSet>
+        </item>
+    </volumeSet>
+    %s
+</DescribeVolumesResponse>`, id, id, next)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	ids, err := VolumeIdsByTags(sr, []TagItem{{"Name", "data"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[vol-72d8f579 vol-842b078f]" {
+		t.Error("Unexpected volume ids", ids)
+	}
+}
+
+// largeVolumeResponse returns a DescribeVolumes response of n attached and tagged volumes.
+func largeVolumeResponse(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/"><volumeSet>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<item><volumeId>vol-%08x</volumeId><size>10</size><availabilityZone>eu-west-1a</availabilityZone>
+<status>in-use</status><createTime>2014-10-06T11:43:23.000Z</createTime><volumeType>gp2</volumeType><encrypted>false</encrypted>
+<attachmentSet><item><volumeId>vol-%08x</volumeId><instanceId>i-7ae3b239</instanceId><device>/dev/sdf</device>
+<status>attached</status><attachTime>2014-10-06T11:43:23.000Z</attachTime></item></attachmentSet>
+<tagSet><item><key>Name</key><value>data</value></item></tagSet></item>`, i, i)
+	}
+	b.WriteString(`</volumeSet></DescribeVolumesResponse>`)
+	return b.Bytes()
+}
+
+func BenchmarkDecodeVolumeIds(b *testing.B) {
+	res := largeVolumeResponse(10000)
+	b.SetBytes(int64(len(res)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := decodeVolumeIds(res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeVolumeSet(t *testing.T) {
+	res := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <size> 80 </size>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <status>in-use</status>
+            <createTime>2014-10-03T15:18:42.354Z</createTime>
+            <volumeType>io1</volumeType>
+            <iops>4000</iops>
+            <throughput>500</throughput>
+            <encrypted>true</encrypted>
+            <snapshotId>snap-1db38de7</snapshotId>
+            <outpostArn>arn:aws:outposts:eu-west-1:123456789012:outpost/op-1234567890abcdef0</outpostArn>
+            <multiAttachEnabled>true</multiAttachEnabled>
+            <attachmentSet>
+                <item>
+                    <volumeId>vol-72d8f579</volumeId>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <device>/dev/sdf</device>
+                    <status>attached</status>
+                    <attachTime>2014-10-03T15:20:42.000Z</attachTime>
+                    <deleteOnTermination>false</deleteOnTermination>
+                </item>
+            </attachmentSet>
+            <tagSet>
+                <item><key>Name</key><value>data &amp; logs</value></item>
+                <item><key>Stack</key><value></value></item>
+            </tagSet>
+        </item>
+        <item>
+            <volumeId>vol-842b078f</volumeId>
+            <status>available</status>
+            <attachmentSet/>
+        </item>
+    </volumeSet>
+    <nextToken>page2</nextToken>
+</DescribeVolumesResponse>`)
+
+	// EC2 compatible endpoints send empty elements rather than leaving them out.
+	empty := []byte(`<DescribeVolumesResponse>
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <size/>
+            <iops></iops>
+            <throughput></throughput>
+            <encrypted></encrypted>
+            <multiAttachEnabled/>
+            <createTime> </createTime>
+            <attachmentSet><item><status/><attachTime/></item></attachmentSet>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+
+	// Every field has to be set by the first fixture, so that fields added to EbsVolume but not to
+	// setVolumeSetField are noticed.
+	full := new(EbsVolumeSet)
+	if err := xml.Unmarshal(res, full); err != nil {
+		t.Fatal(err)
+	}
+	vol := reflect.ValueOf(full.VolumeSet.Items[0])
+	att := reflect.ValueOf(full.VolumeSet.Items[0].AttachmentSet.Items[0])
+	for _, v := range []reflect.Value{vol, att} {
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).IsZero() {
+				t.Errorf("Expected the fixture to set %s.%s", v.Type().Name(), v.Type().Field(i).Name)
+			}
+		}
+	}
+
+	for _, b := range [][]byte{res, empty, largeVolumeResponse(3)} {
+		expected := new(EbsVolumeSet)
+		if err := xml.Unmarshal(b, expected); err != nil {
+			t.Fatal(err)
+		}
+		set, err := decodeVolumeSet(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(set, expected) {
+			t.Errorf("Expected the same result as encoding/xml\n%+v\ngot\n%+v", expected, set)
+		}
+	}
+
+	if _, err := decodeVolumeSet([]byte(`<DescribeVolumesResponse><volumeSet><item><size>big</size></item></volumeSet></DescribeVolumesResponse>`)); err == nil {
+		t.Error("Expected invalid size to fail")
+	}
+}
+
+// BenchmarkUnmarshalVolumeSet measures decodeVolumeSet, used for DescribeVolumes, against the same response as
+// BenchmarkDecodeVolumeSet which uses encoding/xml.
+func BenchmarkUnmarshalVolumeSet(b *testing.B) {
+	res := largeVolumeResponse(10000)
+	b.SetBytes(int64(len(res)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeVolumeSet(res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeVolumeSet(b *testing.B) {
+	res := largeVolumeResponse(10000)
+	b.SetBytes(int64(len(res)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := xml.Unmarshal(res, new(EbsVolumeSet)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSortVolumes(t *testing.T) {
+	day := func(d int) Timestamp {
+		return Timestamp{time.Date(2014, 10, d, 0, 0, 0, 0, time.UTC)}
+	}
+	vols := []EbsVolume{
+		{Id: "vol-a", Size: 10, CreatedAt: day(3)},
+		{Id: "vol-b", Size: 80, CreatedAt: day(1)},
+		{Id: "vol-c", Size: 10, CreatedAt: day(3)},
+		{Id: "vol-d", Size: 80, CreatedAt: day(2)},
+		{Id: "vol-e", Size: 10, CreatedAt: day(1)},
+	}
+	ids := func() string {
+		var ids []string
+		for _, vol := range vols {
+			ids = append(ids, vol.Id)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	SortVolumesByAge(vols)
+	if e := "[vol-b vol-e vol-d vol-a vol-c]"; ids() != e {
+		t.Errorf("Expected oldest first keeping the order of ties %s, got %s", e, ids())
+	}
+	SortVolumesBySize(vols)
+	if e := "[vol-b vol-d vol-e vol-a vol-c]"; ids() != e {
+		t.Errorf("Expected largest first keeping the order of ties %s, got %s", e, ids())
+	}
+
+	vol := EbsVolume{CreatedAt: Timestamp{time.Now().Add(-time.Hour)}}
+	if age := vol.Age(); age < time.Hour || age > 2*time.Hour {
+		t.Error("Expected an age of about an hour, got", age)
+	}
+}
+
+func TestVolumeReuse(t *testing.T) {
+	attached := EbsVolume{AvailabilityZone: "eu-west-1a", Status: VolumeInUse}
+	attached.AttachmentSet.Items = []EbsVolumeAttachementResponse{{InstanceId: "i-7ae3b239", Status: VolumeAttached}}
+	cases := []struct {
+		vol      EbsVolume
+		az       string
+		migrate  bool
+		reusable bool
+	}{
+		{EbsVolume{AvailabilityZone: "eu-west-1a", Status: VolumeAvailable}, "eu-west-1a", false, true},
+		{EbsVolume{AvailabilityZone: "eu-west-1a", Status: VolumeAvailable}, "eu-west-1b", true, false},
+		{EbsVolume{AvailabilityZone: "eu-west-1a", Status: VolumeCreating}, "eu-west-1a", false, false},
+		{attached, "eu-west-1a", false, true},
+		{attached, "eu-west-1b", true, false},
+	}
+	for _, c := range cases {
+		if m := c.vol.NeedsMigration(c.az); m != c.migrate {
+			t.Errorf("Expected NeedsMigration of %s volume in %s to %s to be %t", c.vol.Status, c.vol.AvailabilityZone, c.az, c.migrate)
+		}
+		if r := c.vol.CanReuseIn(c.az, "i-7ae3b239"); r != c.reusable {
+			t.Errorf("Expected CanReuseIn of %s volume in %s to %s to be %t", c.vol.Status, c.vol.AvailabilityZone, c.az, c.reusable)
+		}
+	}
+	if attached.CanReuseIn("eu-west-1a", "i-842b078f") {
+		t.Error("Expected a volume attached to another instance not to be reusable")
+	}
+}
+
+func TestVolumeRefresh(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("VolumeId.1"); id != "vol-72d8f579" {
+			t.Error("Unexpected volume", id)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <size>80</size>
+            <status>available</status>
+            <tagSet><item><key>Name</key><value>data</value></item></tagSet>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vol := &EbsVolume{Id: "vol-72d8f579", Size: 80, Status: VolumeCreating}
+	if err := vol.Refresh(sr); err != nil {
+		t.Fatal(err)
+	}
+	if vol.Status != VolumeAvailable || len(vol.TagSet.Items) != 1 || vol.TagSet.Items[0].Value != "data" {
+		t.Error("Expected the status and tags to be updated, got", vol)
+	}
+}
+
+func TestVolumeByIdAllowDeleted(t *testing.T) {
+	statuses := []string{"deleting", "deleting", ""}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		if status == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>InvalidVolume.NotFound</Code><Message>The volume 'vol-72d8f579' does not exist.</Message></Error></Errors></Response>`)
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <status>%s</status>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, status)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+
+	if vol, err := VolumeByIdAllowDeleted(sr, "vol-72d8f579"); err != nil || vol.Status != VolumeDeleting {
+		t.Error("Expected the deleting volume, got", vol, err)
+	}
+	vol, err := WaitForVolumeStatus(context.Background(), sr, "vol-72d8f579", VolumeDeleted, nil)
+	if err != nil || vol.Status != VolumeDeleted {
+		t.Error("Expected the volume that is gone to count as deleted, got", vol, err)
+	}
+	if _, err := VolumeByIdAllowDeleted(sr, "vol-72d8f579"); err != ErrNotFound {
+		t.Error("Expected ErrNotFound once the volume is gone, got", err)
+	}
+}
+
+func TestVolumesBySnapshot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeVolumes" || q.Get("Filter.1.Name") != "snapshot-id" || q.Get("Filter.1.Value.1") != "snap-1db38de7" {
+			t.Error("Expected snapshot-id filter, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <snapshotId>snap-1db38de7</snapshotId>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vols, err := VolumesBySnapshot(sr, "snap-1db38de7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 1 || vols[0].SnapshotId != "snap-1db38de7" {
+		t.Error("Expected the volume created from the snapshot, got", vols)
+	}
+}
+
+func TestForEachVolume(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Filter.1.Name") != "status" {
+			t.Error("Expected the status filter, got", q)
+		}
+		next := map[string]string{"": "page2", "page2": "page3"}[q.Get("NextToken")]
+		if next != "" {
+			next = "<nextToken>" + next + "</nextToken>"
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item><volumeId>vol-%[1]s-a</volumeId></item>
+        <item><volumeId>vol-%[1]s-b</volumeId></item>
+    </volumeSet>
+    %[2]s
+</DescribeVolumesResponse>`, q.Get("NextToken"), next)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	filters := []Filter{{"status", []string{"available"}}}
+
+	var visited []string
+	err := ForEachVolume(context.Background(), sr, filters, func(vol EbsVolume) error {
+		visited = append(visited, vol.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := "[vol--a vol--b vol-page2-a vol-page2-b vol-page3-a vol-page3-b]"; fmt.Sprint(visited) != e {
+		t.Errorf("Expected every volume of every page %s, got %v", e, visited)
+	}
+
+	stop := errors.New("stop")
+	visited = nil
+	err = ForEachVolume(context.Background(), sr, filters, func(vol EbsVolume) error {
+		visited = append(visited, vol.Id)
+		if len(visited) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(visited) != 3 {
+		t.Error("Expected to stop at the error of fn, got", err, visited)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ForEachVolume(ctx, sr, filters, func(EbsVolume) error { return nil }); err != context.Canceled {
+		t.Error("Expected the cancelled context to stop the iteration, got", err)
+	}
+}
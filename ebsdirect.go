@@ -0,0 +1,101 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// EBSDirectRequestBuilder turns the actions of the EBS direct APIs into the REST requests they are, for use
+// with WithRequestBuilder by requesters sending to EBSDirectEndpoint and signing for the ebs service.
+var EBSDirectRequestBuilder = RequestBuilderFunc(func(endpoint string, values url.Values) (*http.Request, error) {
+	var path string
+	query := make(url.Values)
+	switch action := values.Get("Action"); action {
+	case "ListSnapshotBlocks":
+		path = "/snapshots/" + url.PathEscape(values.Get("SnapshotId")) + "/blocks"
+	case "ListChangedBlocks":
+		path = "/snapshots/" + url.PathEscape(values.Get("SecondSnapshotId")) + "/changedblocks"
+		query.Set("firstSnapshotId", values.Get("FirstSnapshotId"))
+	default:
+		return nil, fmt.Errorf("%s is not an action of the EBS direct APIs", action)
+	}
+	if token := values.Get("NextToken"); token != "" {
+		query.Set("pageToken", token)
+	}
+
+	req, err := http.NewRequest("GET", endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+})
+
+// EBSDirectEndpoint returns the endpoint of the EBS direct APIs in the region.
+func EBSDirectEndpoint(region string) string {
+	return "https://ebs." + region + "." + PartitionForRegion(region).DNSSuffix
+}
+
+// BlockToken identifies a block of a snapshot, the token is needed to read its data with the GetSnapshotBlock API.
+type BlockToken struct {
+	Index int    `json:"BlockIndex"`
+	Token string `json:"BlockToken"`
+}
+
+// SnapshotBlocks returns the blocks holding data in the snapshot, following pagination. The requester has
+// to use EBSDirectRequestBuilder.
+func SnapshotBlocks(sr SignedRequester, snapshotId string) ([]BlockToken, error) {
+	values := url.Values{"Action": {"ListSnapshotBlocks"}, "SnapshotId": {snapshotId}}
+
+	var blocks []BlockToken
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		page := &struct {
+			Blocks    []BlockToken
+			NextToken string
+		}{}
+		if err := json.Unmarshal(b, page); err != nil {
+			return "", err
+		}
+		blocks = append(blocks, page.Blocks...)
+		return page.NextToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// ChangedBlocks returns the blocks that differ between two snapshots of the same volume, the first being the
+// older one, following pagination. The tokens read the blocks of the second snapshot, they are empty for
+// blocks that no longer hold data. The requester has to use EBSDirectRequestBuilder.
+func ChangedBlocks(sr SignedRequester, firstSnapshotId, secondSnapshotId string) ([]BlockToken, error) {
+	values := url.Values{
+		"Action":           {"ListChangedBlocks"},
+		"FirstSnapshotId":  {firstSnapshotId},
+		"SecondSnapshotId": {secondSnapshotId},
+	}
+
+	var blocks []BlockToken
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		page := &struct {
+			ChangedBlocks []struct {
+				BlockIndex       int
+				SecondBlockToken string
+			}
+			NextToken string
+		}{}
+		if err := json.Unmarshal(b, page); err != nil {
+			return "", err
+		}
+		for _, block := range page.ChangedBlocks {
+			blocks = append(blocks, BlockToken{block.BlockIndex, block.SecondBlockToken})
+		}
+		return page.NextToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSnapshotBlocks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/snapshots/snap-1db38de7/blocks" {
+			t.Error("Unexpected path", r.URL.Path)
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprint(w, `{"BlockSize":524288,"Blocks":[{"BlockIndex":0,"BlockToken":"AAABAV3"},{"BlockIndex":2,"BlockToken":"AAABAV4"}],"NextToken":"page2","VolumeSize":8}`)
+			return
+		}
+		fmt.Fprint(w, `{"BlockSize":524288,"Blocks":[{"BlockIndex":7,"BlockToken":"AAABAV5"}],"VolumeSize":8}`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, testV4Signer(WithSigningService("ebs")), WithRequestBuilder(EBSDirectRequestBuilder))
+
+	blocks, err := SnapshotBlocks(sr, "snap-1db38de7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(blocks) != "[{0 AAABAV3} {2 AAABAV4} {7 AAABAV5}]" {
+		t.Error("Expected the blocks of both pages, got", blocks)
+	}
+}
+
+func TestChangedBlocks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/snapshots/snap-72d8f579/changedblocks" {
+			t.Error("Unexpected path", r.URL.Path)
+		}
+		if r.URL.Query().Get("firstSnapshotId") != "snap-1db38de7" {
+			w.Header().Set("X-Amzn-ErrorType", "ResourceNotFoundException:http://internal.amazon.com/coral/com.amazonaws.ebs/")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"Message":"The snapshot does not exist"}`)
+			return
+		}
+		fmt.Fprint(w, `{"BlockSize":524288,"ChangedBlocks":[{"BlockIndex":1,"FirstBlockToken":"AAABAV3","SecondBlockToken":"AAABAV6"},{"BlockIndex":4,"FirstBlockToken":"AAABAV4"}],"VolumeSize":8}`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, testV4Signer(WithSigningService("ebs")), WithRequestBuilder(EBSDirectRequestBuilder))
+
+	blocks, err := ChangedBlocks(sr, "snap-1db38de7", "snap-72d8f579")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(blocks) != "[{1 AAABAV6} {4 }]" {
+		t.Error("Expected the changed blocks with the tokens of the second snapshot, got", blocks)
+	}
+
+	if _, err := ChangedBlocks(sr, "snap-gone", "snap-72d8f579"); ErrorCode(err) != "ResourceNotFoundException" {
+		t.Error("Expected the error named by the header, got", err)
+	}
+}
+
+func TestEBSDirectEndpoint(t *testing.T) {
+	if e := EBSDirectEndpoint("cn-north-1"); e != "https://ebs.cn-north-1.amazonaws.com.cn" {
+		t.Error("Unexpected endpoint", e)
+	}
+}
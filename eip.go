@@ -1,9 +1,7 @@
 package aws
 
 import (
-	"encoding/xml"
-	"errors"
-	"net/url"
+	"time"
 )
 
 type EipAddress struct {
@@ -11,50 +9,88 @@ type EipAddress struct {
 	AllocationId  string `xml:"allocationId"`
 	InstanceId    string `xml:"instanceId"`
 	AssociationId string `xml:"associationId"`
+	// Domain is vpc for VPC addresses and standard for EC2-Classic ones.
+	Domain string `xml:"domain"`
+	TagSet struct {
+		Items []TagItem `xml:"item"`
+	} `xml:"tagSet"`
 }
 
+// AllocateAddress allocates a new VPC address with the specified tags.
+func AllocateAddress(sr SignedRequester, tags []TagItem) (*EipAddress, error) {
+	p := params{"Version": latestAPIVersion, "Domain": "vpc"}
+	addTagSpecification(p, "elastic-ip", tags)
+
+	eip := new(EipAddress)
+	if err := call(sr, "AllocateAddress", p, eip); err != nil {
+		return nil, err
+	}
+	// The response doesn't include the tags applied on allocation.
+	eip.TagSet.Items = tags
+	return eip, nil
+}
+
+// consistencyDelays are waited between attempts of requests failing because a resource that was just created
+// isn't visible yet to every part of EC2.
+var consistencyDelays = []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second}
+
+// AssociateAddress associates the address with the instance, retrying for a few seconds if the address or
+// instance is not found since that is common right after they were created.
 func AssociateAddress(sr SignedRequester, instance, ip string) error {
-	// Allocattion Id is required for VPC
 	eip, err := DescribeAddress(sr, ip)
 	if err != nil {
 		return err
 	}
 
-	values := make(url.Values)
-	values.Add("Action", "AssociateAddress")
-	values.Add("AllocationId", eip.AllocationId)
-	values.Add("InstanceId", instance)
-	values.Add("AllowReassociation", "true")
-
-	if _, err := sr.SignedRequest(values); err != nil {
-		return err
+	// VPC addresses are referred to by allocation id, EC2-Classic ones by their ip.
+	p := params{"InstanceId": instance}
+	if eip.Domain == "standard" {
+		p["PublicIp"] = eip.PublicIp
+	} else {
+		p["AllocationId"] = eip.AllocationId
+		p["AllowReassociation"] = "true"
+	}
+	for attempt := 0; ; attempt++ {
+		err := call(sr, "AssociateAddress", p, nil)
+		code := ErrorCode(err)
+		if code != "InvalidAllocationID.NotFound" && code != "InvalidInstanceID.NotFound" || attempt == len(consistencyDelays) {
+			return err
+		}
+		<-clockOf(sr).After(consistencyDelays[attempt])
 	}
-
-	return nil
 }
 
 func DescribeAddress(sr SignedRequester, ip string) (*EipAddress, error) {
-	values := make(url.Values)
-	values.Add("Action", "DescribeAddresses")
-	values.Add("PublicIp.1", ip)
-
-	res, err := sr.SignedRequest(values)
-	if err != nil {
-		return nil, err
-	}
-
 	addresses := struct {
 		AddressesSet struct {
 			Items []*EipAddress `xml:"item"`
 		} `xml:"addressesSet"`
 	}{}
-
-	if err := xml.Unmarshal(res, &addresses); err != nil {
+	if err := call(sr, "DescribeAddresses", params{"PublicIp.1": ip}, &addresses); err != nil {
 		return nil, err
 	}
 
-	if len(addresses.AddressesSet.Items) != 1 {
-		return nil, errors.New("Could not find the address")
+	if err := expectOne("address", ip, len(addresses.AddressesSet.Items)); err != nil {
+		return nil, err
 	}
 	return addresses.AddressesSet.Items[0], nil
 }
+
+// AddressesByTags returns the addresses having all of the specified tags, ErrNoTags without any.
+func AddressesByTags(sr SignedRequester, tags []TagItem) ([]EipAddress, error) {
+	if len(tags) == 0 {
+		return nil, ErrNoTags
+	}
+	p := make(params)
+	addFilters(p, TagFilters(tags))
+
+	addresses := struct {
+		AddressesSet struct {
+			Items []EipAddress `xml:"item"`
+		} `xml:"addressesSet"`
+	}{}
+	if err := call(sr, "DescribeAddresses", p, &addresses); err != nil {
+		return nil, err
+	}
+	return addresses.AddressesSet.Items, nil
+}
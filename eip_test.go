@@ -0,0 +1,200 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAddressesByTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeAddresses" || q.Get("Filter.1.Name") != "tag:Name" || q.Get("Filter.1.Value.1") != "web" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeAddressesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>f7de5e98-491a-4c19-a92d-908d6EXAMPLE</requestId>
+    <addressesSet>
+        <item>
+            <publicIp>203.0.113.41</publicIp>
+            <allocationId>eipalloc-08229861</allocationId>
+            <domain>vpc</domain>
+            <instanceId>i-0598c7d356eba48d7</instanceId>
+            <associationId>eipassoc-f0229899</associationId>
+            <tagSet>
+                <item>
+                    <key>Name</key>
+                    <value>web</value>
+                </item>
+            </tagSet>
+        </item>
+    </addressesSet>
+</DescribeAddressesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	addresses, err := AddressesByTags(sr, []TagItem{{"Name", "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 1 {
+		t.Fatal("Expected one address, got", len(addresses))
+	}
+	eip := addresses[0]
+	if eip.PublicIp != "203.0.113.41" || eip.AllocationId != "eipalloc-08229861" {
+		t.Error("Unexpected address", eip)
+	}
+	if tags := []TagItem{{"Name", "web"}}; !reflect.DeepEqual(eip.TagSet.Items, tags) {
+		t.Error("Expected tags", tags, "got", eip.TagSet.Items)
+	}
+}
+
+func TestAddressesByTagsWithoutTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request without tags, got", r.URL.Query())
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if _, err := AddressesByTags(sr, nil); err != ErrNoTags {
+		t.Error("Expected ErrNoTags, got", err)
+	}
+}
+
+func TestAllocateAddress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Version") != latestAPIVersion || q.Get("Domain") != "vpc" {
+			t.Error("Unexpected request", q)
+		}
+		if q.Get("TagSpecification.1.ResourceType") != "elastic-ip" || q.Get("TagSpecification.1.Tag.1.Key") != "Name" ||
+			q.Get("TagSpecification.1.Tag.1.Value") != "web" {
+			t.Error("Expected tag specification, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<AllocateAddressResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+   <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+   <publicIp>198.51.100.1</publicIp>
+   <domain>vpc</domain>
+   <allocationId>eipalloc-5723d13e</allocationId>
+</AllocateAddressResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	eip, err := AllocateAddress(sr, []TagItem{{"Name", "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eip.AllocationId != "eipalloc-5723d13e" || eip.PublicIp != "198.51.100.1" {
+		t.Error("Unexpected address", eip)
+	}
+}
+
+func TestAssociateAddressEventualConsistency(t *testing.T) {
+	notFound := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch action := r.URL.Query().Get("Action"); action {
+		case "DescribeAddresses":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeAddressesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <addressesSet>
+        <item>
+            <publicIp>203.0.113.41</publicIp>
+            <allocationId>eipalloc-08229861</allocationId>
+        </item>
+    </addressesSet>
+</DescribeAddressesResponse>`)
+		case "AssociateAddress":
+			if notFound > 0 {
+				notFound--
+				w.WriteHeader(400)
+				fmt.Fprint(w, `<Response><Errors><Error><Code>InvalidAllocationID.NotFound</Code><Message>The allocation ID 'eipalloc-08229861' does not exist</Message></Error></Errors></Response>`)
+				return
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<AssociateAddressResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+    <associationId>eipassoc-fc5ca095</associationId>
+</AssociateAddressResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(clock))
+
+	if err := AssociateAddress(sr, "i-7ae3b239", "203.0.113.41"); err != nil {
+		t.Error(err)
+	}
+	if fmt.Sprint(clock.sleeps) != "[500ms 1s]" {
+		t.Error("Expected two retries, waited", clock.sleeps)
+	}
+
+	notFound = len(consistencyDelays) + 1
+	if err := AssociateAddress(sr, "i-7ae3b239", "203.0.113.41"); ErrorCode(err) != "InvalidAllocationID.NotFound" {
+		t.Error("Expected to give up after the consistency window, got", err)
+	}
+}
+
+func TestAssociateAddressDomain(t *testing.T) {
+	domain := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeAddresses":
+			allocation := ""
+			if domain == "vpc" {
+				allocation = "<allocationId>eipalloc-08229861</allocationId>"
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeAddressesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <addressesSet>
+        <item>
+            <publicIp>203.0.113.41</publicIp>
+            %s
+            <domain>%s</domain>
+        </item>
+    </addressesSet>
+</DescribeAddressesResponse>`, allocation, domain)
+		case "AssociateAddress":
+			switch domain {
+			case "vpc":
+				if q.Get("AllocationId") != "eipalloc-08229861" || q.Get("PublicIp") != "" {
+					t.Error("Expected the allocation id of the VPC address, got", q)
+				}
+			case "standard":
+				if q.Get("PublicIp") != "203.0.113.41" || q.Get("AllocationId") != "" || q.Get("AllowReassociation") != "" {
+					t.Error("Expected the ip of the EC2-Classic address, got", q)
+				}
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<AssociateAddressResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</AssociateAddressResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	for _, domain = range []string{"vpc", "standard"} {
+		if eip, err := DescribeAddress(sr, "203.0.113.41"); err != nil || eip.Domain != domain {
+			t.Errorf("Expected domain %s, got %v %v", domain, eip, err)
+		}
+		if err := AssociateAddress(sr, "i-7ae3b239", "203.0.113.41"); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package aws
+
+// DefaultEbsKmsKey returns the KMS key new volumes are encrypted with unless another key is specified, the
+// alias/aws/ebs key managed by Amazon if the account didn't choose one.
+func DefaultEbsKmsKey(sr SignedRequester) (string, error) {
+	res := &struct {
+		KmsKeyId string `xml:"kmsKeyId"`
+	}{}
+	if err := call(sr, "GetEbsDefaultKmsKeyId", params{"Version": latestAPIVersion}, res); err != nil {
+		return "", err
+	}
+	return res.KmsKeyId, nil
+}
+
+// EbsEncryptionByDefault reports whether new volumes of the account are encrypted in the region even when
+// they aren't requested to be.
+func EbsEncryptionByDefault(sr SignedRequester) (bool, error) {
+	res := &struct {
+		Enabled bool `xml:"ebsEncryptionByDefault"`
+	}{}
+	if err := call(sr, "GetEbsEncryptionByDefault", params{"Version": latestAPIVersion}, res); err != nil {
+		return false, err
+	}
+	return res.Enabled, nil
+}
@@ -0,0 +1,47 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEbsEncryptionDefaults(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Version") != latestAPIVersion {
+			t.Error("Expected the latest API version, got", q.Get("Version"))
+		}
+		switch action := q.Get("Action"); action {
+		case "GetEbsDefaultKmsKeyId":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<GetEbsDefaultKmsKeyIdResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>5c5a4e38-2ba3-4b0a-9d38-EXAMPLE</requestId>
+    <kmsKeyId>arn:aws:kms:eu-west-1:123456789012:key/0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d</kmsKeyId>
+</GetEbsDefaultKmsKeyIdResponse>`)
+		case "GetEbsEncryptionByDefault":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<GetEbsEncryptionByDefaultResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>5c5a4e38-2ba3-4b0a-9d38-EXAMPLE</requestId>
+    <ebsEncryptionByDefault>true</ebsEncryptionByDefault>
+</GetEbsEncryptionByDefaultResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, StrictDecoding())
+
+	key, err := DefaultEbsKmsKey(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "arn:aws:kms:eu-west-1:123456789012:key/0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d" {
+		t.Error("Unexpected key", key)
+	}
+	if enabled, err := EbsEncryptionByDefault(sr); err != nil || !enabled {
+		t.Error("Expected encryption by default to be enabled, got", enabled, err)
+	}
+}
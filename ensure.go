@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"context"
+)
+
+// EnsureVolume returns the volume with the specified name, creating it according to spec if there is none.
+// The volume is tagged with the name in addition to the tags of the spec. The returned bool reports whether
+// the volume was created, it is safe to call again, e.g. after the volume was created but waiting for it failed.
+func EnsureVolume(ctx context.Context, sr SignedRequester, name string, spec VolumeSpec) (*EbsVolume, bool, error) {
+	tags := []TagItem{{Key: "Name", Value: name}}
+	// Two volumes are enough to tell that the name is ambiguous.
+	vols, err := VolumesByTags(sr, tags, Limit(2))
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch len(vols) {
+	case 0:
+	case 1:
+		if vols[0].Status != VolumeCreating {
+			return &vols[0], false, nil
+		}
+		vol, err := WaitForVolumeStatus(ctx, sr, vols[0].Id, VolumeAvailable, nil)
+		return vol, false, err
+	default:
+		return nil, false, expectOne("volume", name, len(vols))
+	}
+
+	for _, tag := range spec.Tags {
+		if tag.Key != "Name" {
+			tags = append(tags, tag)
+		}
+	}
+	spec.Tags = tags
+	vol, err := CreateVolumeSpec(sr, spec)
+	if err != nil {
+		return nil, false, err
+	}
+	vol, err = WaitForVolumeStatus(ctx, sr, vol.Id, VolumeAvailable, nil)
+	return vol, true, err
+}
+
+// AdoptVolume brings a volume created by other means under management, the counterpart of EnsureVolume for
+// existing volumes. The tags are applied overwriting any values present and the updated volume is returned.
+func AdoptVolume(sr SignedRequester, volumeId string, tags []TagItem) (*EbsVolume, error) {
+	if err := EnsureTags(sr, volumeId, tags, true); err != nil {
+		return nil, err
+	}
+	return VolumeById(sr, volumeId)
+}
+
+// ResolveVolumeByName returns the volume with the specified name. When several volumes share the name, e.g.
+// after a failed migration, prefer picks one of them; an AmbiguousError is returned if it is nil or returns nil.
+func ResolveVolumeByName(sr SignedRequester, name string, prefer func([]EbsVolume) *EbsVolume) (*EbsVolume, error) {
+	vols, err := VolumesByTags(sr, []TagItem{{Key: "Name", Value: name}})
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) > 1 && prefer != nil {
+		if vol := prefer(vols); vol != nil {
+			return vol, nil
+		}
+	}
+	if err := expectOne("volume", name, len(vols)); err != nil {
+		return nil, err
+	}
+	return &vols[0], nil
+}
+
+// PreferAttached picks the only volume attached to an instance, or none if zero or several are attached.
+func PreferAttached(vols []EbsVolume) *EbsVolume {
+	var attached *EbsVolume
+	for i := range vols {
+		if vols[i].Status != VolumeInUse {
+			continue
+		}
+		if attached != nil {
+			return nil
+		}
+		attached = &vols[i]
+	}
+	return attached
+}
+
+// PreferNewest picks the most recently created volume, or none if several were created at the same time.
+func PreferNewest(vols []EbsVolume) *EbsVolume {
+	var newest *EbsVolume
+	tie := false
+	for i := range vols {
+		switch {
+		case newest == nil || vols[i].CreatedAt.After(newest.CreatedAt.Time):
+			newest, tie = &vols[i], false
+		case vols[i].CreatedAt.Equal(newest.CreatedAt.Time):
+			tie = true
+		}
+	}
+	if tie {
+		return nil
+	}
+	return newest
+}
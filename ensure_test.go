@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnsureVolume(t *testing.T) {
+	volumes := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeVolumes":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>%s</volumeSet>
+</DescribeVolumesResponse>`, volumes)
+		case "CreateVolume":
+			if q.Get("AvailabilityZone") != "eu-west-1a" || q.Get("Size") != "20" || q.Get("VolumeType") != "gp2" {
+				t.Error("Unexpected CreateVolume params", q)
+			}
+			volumes = `<item><volumeId>vol-842b078f</volumeId><status>available</status></item>`
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeId>vol-842b078f</volumeId>
+    <status>creating</status>
+</CreateVolumeResponse>`)
+		case "CreateTags":
+			if q.Get("Tag.1.Key") != "Name" || q.Get("Tag.1.Value") != "data" || q.Get("Tag.2.Key") != "Stack" || q.Get("Tag.3.Key") != "" {
+				t.Error("Unexpected tags", q)
+			}
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+	spec := VolumeSpec{Size: 20, SSD: true, AZ: "eu-west-1a", Tags: []TagItem{{"Name", "ignored"}, {"Stack", "test"}}}
+
+	vol, created, err := EnsureVolume(context.Background(), sr, "data", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || vol.Id != "vol-842b078f" || vol.Status != VolumeAvailable {
+		t.Error("Expected an available volume to be created, got", vol, created)
+	}
+
+	// The volume exists now, calling again must not create another one.
+	if vol, created, err = EnsureVolume(context.Background(), sr, "data", spec); err != nil {
+		t.Fatal(err)
+	}
+	if created || vol.Id != "vol-842b078f" {
+		t.Error("Expected the existing volume, got", vol, created)
+	}
+
+	volumes += `<item><volumeId>vol-72d8f579</volumeId></item>`
+	if _, _, err := EnsureVolume(context.Background(), sr, "data", spec); err == nil {
+		t.Error("Expected several volumes with the same name to fail")
+	}
+}
+
+func TestAdoptVolume(t *testing.T) {
+	tags := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "CreateTags":
+			if q.Get("ResourceId.1") != "vol-842b078f" || q.Get("Tag.1.Key") != "Name" || q.Get("Tag.1.Value") != "data" {
+				t.Error("Unexpected CreateTags params", q)
+			}
+			tags = `<item><key>Name</key><value>data</value></item>`
+		case "DescribeVolumes":
+			if q.Get("VolumeId.1") != "vol-842b078f" {
+				t.Error("Unexpected volume id", q)
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-842b078f</volumeId>
+            <status>available</status>
+            <tagSet>%s</tagSet>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, tags)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	vol, err := AdoptVolume(sr, "vol-842b078f", []TagItem{{"Name", "data"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.Id != "vol-842b078f" || len(vol.TagSet.Items) != 1 || vol.TagSet.Items[0].Value != "data" {
+		t.Error("Expected the volume to be returned with its new tags, got", vol)
+	}
+}
+
+func TestResolveVolumeByName(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Filter.1.Name") != "tag:Name" || q.Get("Filter.1.Value.1") != "data" {
+			t.Error("Expected Name tag filter, got", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <status>in-use</status>
+            <createTime>2014-10-03T15:18:42.354Z</createTime>
+        </item>
+        <item>
+            <volumeId>vol-842b078f</volumeId>
+            <status>available</status>
+            <createTime>2014-10-05T09:01:12.000Z</createTime>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if _, err := ResolveVolumeByName(sr, "data", nil); err == nil {
+		t.Error("Expected ambiguous name without preference to fail")
+	} else if _, ok := err.(*AmbiguousError); !ok {
+		t.Error("Expected AmbiguousError, got", err)
+	}
+	if vol, err := ResolveVolumeByName(sr, "data", PreferAttached); err != nil || vol.Id != "vol-72d8f579" {
+		t.Error("Expected the attached volume, got", vol, err)
+	}
+	if vol, err := ResolveVolumeByName(sr, "data", PreferNewest); err != nil || vol.Id != "vol-842b078f" {
+		t.Error("Expected the newest volume, got", vol, err)
+	}
+	none := func([]EbsVolume) *EbsVolume { return nil }
+	if _, err := ResolveVolumeByName(sr, "data", none); err == nil {
+		t.Error("Expected undecided preference to fail")
+	}
+}
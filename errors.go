@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by lookups of a single resource when it doesn't exist.
+var ErrNotFound = errors.New("Could not find the specified resource")
+
+// ErrNoTags is returned by the lookups by tags when no tags are given, which would otherwise match everything
+// in the account. Use AllVolumes or the filter based lookups to list everything on purpose.
+var ErrNoTags = errors.New("At least one tag is required to look up by tags")
+
+// AmbiguousError is returned by lookups of a single resource when more than one matched.
+type AmbiguousError struct {
+	Resource string
+	Id       string
+	Count    int
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("Expected exactly one %s matching %s, found %d", e.Resource, e.Id, e.Count)
+}
+
+// ErrSnapshotInUse matches the SnapshotInUseError returned by DeleteSnapshotSafe using errors.Is.
+var ErrSnapshotInUse = errors.New("Snapshot is in use by an image")
+
+// SnapshotInUseError is returned when a snapshot can't be deleted because images are based on it.
+type SnapshotInUseError struct {
+	SnapshotId string
+	ImageIds   []string
+}
+
+func (e *SnapshotInUseError) Error() string {
+	return fmt.Sprintf("Snapshot %s is in use by %s, deregister the images first", e.SnapshotId, strings.Join(e.ImageIds, ", "))
+}
+
+func (e *SnapshotInUseError) Unwrap() error {
+	return ErrSnapshotInUse
+}
+
+// IsDryRunSuccess reports whether the error is Amazon's answer to a request sent with DryRun that would have
+// succeeded otherwise.
+func IsDryRunSuccess(err error) bool {
+	return ErrorCode(err) == "DryRunOperation"
+}
+
+// expectOne returns the error describing why a lookup of a single resource returned count results.
+func expectOne(resource, id string, count int) error {
+	switch count {
+	case 0:
+		return ErrNotFound
+	case 1:
+		return nil
+	}
+	return &AmbiguousError{resource, id, count}
+}
+
+// APIError is returned when Amazon responds to a request with an error.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestId  string
+	// ServerTime is Amazon's time according to the Date header of the response, zero if missing.
+	ServerTime time.Time
+	// RetryAfter is how long Amazon asked us to wait before retrying using the Retry-After header, zero if missing.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	if isClockSkewCode(e.Code) {
+		return e.Code + ": " + e.Message + " (check that the system clock is correct)"
+	}
+	return e.Code + ": " + e.Message
+}
+
+// isClockSkewCode reports whether the error code may be caused by the local clock being wrong.
+func isClockSkewCode(code string) bool {
+	switch code {
+	case "RequestExpired", "RequestTimeTooSkewed", "SignatureDoesNotMatch":
+		return true
+	}
+	return false
+}
+
+// newAPIError parses the error response, keeping the whole body as message if it isn't the expected XML.
+func newAPIError(status int, b []byte) *APIError {
+	type errorItem struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	// EC2 nests the errors in Errors while other query APIs, and some emulators, return a single Error.
+	res := &struct {
+		Errors    []errorItem `xml:"Errors>Error"`
+		Error     []errorItem `xml:"Error"`
+		RequestId string      `xml:"RequestID"`
+		RequestID string      `xml:"RequestId"`
+	}{}
+	if err := xml.Unmarshal(b, res); err != nil {
+		return &APIError{StatusCode: status, Message: string(b)}
+	}
+
+	items := append(res.Errors, res.Error...)
+	if len(items) == 0 {
+		return &APIError{StatusCode: status, Message: string(b)}
+	}
+	return &APIError{StatusCode: status, Code: items[0].Code, Message: items[0].Message, RequestId: res.RequestId + res.RequestID}
+}
+
+// ErrorCode returns the code of an APIError, e.g. InvalidVolume.NotFound, or empty string for other errors.
+func ErrorCode(err error) string {
+	if e, ok := err.(*APIError); ok {
+		return e.Code
+	}
+	return ""
+}
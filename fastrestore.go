@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type FastRestoreState string
+
+// enabling | optimizing | enabled | disabling | disabled
+var (
+	FastRestoreEnabling   FastRestoreState = "enabling"
+	FastRestoreOptimizing FastRestoreState = "optimizing"
+	FastRestoreEnabled    FastRestoreState = "enabled"
+	FastRestoreDisabling  FastRestoreState = "disabling"
+	FastRestoreDisabled   FastRestoreState = "disabled"
+)
+
+func (s FastRestoreState) String() string {
+	return string(s)
+}
+
+// FastSnapshotRestore is the state of fast snapshot restore of a snapshot in an availability zone.
+type FastSnapshotRestore struct {
+	SnapshotId       string           `xml:"snapshotId"`
+	AvailabilityZone string           `xml:"availabilityZone"`
+	State            FastRestoreState `xml:"state"`
+	Reason           string           `xml:"stateTransitionReason"`
+}
+
+// EnableFastSnapshotRestore enables fast snapshot restore of the snapshot in the availability zones, so that
+// volumes created from it there are fully initialized right away.
+func EnableFastSnapshotRestore(sr SignedRequester, snapshotId string, azs []string) error {
+	return modifyFastSnapshotRestore(sr, "EnableFastSnapshotRestores", snapshotId, azs)
+}
+
+// DisableFastSnapshotRestore disables fast snapshot restore of the snapshot in the availability zones.
+func DisableFastSnapshotRestore(sr SignedRequester, snapshotId string, azs []string) error {
+	return modifyFastSnapshotRestore(sr, "DisableFastSnapshotRestores", snapshotId, azs)
+}
+
+func modifyFastSnapshotRestore(sr SignedRequester, action, snapshotId string, azs []string) error {
+	p := params{"Version": latestAPIVersion, "SourceSnapshotId.1": snapshotId}
+	for n, az := range azs {
+		p.Set(fmt.Sprintf("AvailabilityZone.%d", n+1), az)
+	}
+
+	// Amazon responds successfully even when some of the zones failed.
+	res := &struct {
+		Successful struct {
+			Items []FastSnapshotRestore `xml:"item"`
+		} `xml:"successful"`
+		Unsuccessful struct {
+			Items []struct {
+				SnapshotId string `xml:"snapshotId"`
+				Errors     []struct {
+					AvailabilityZone string `xml:"availabilityZone"`
+					Code             string `xml:"error>code"`
+					Message          string `xml:"error>message"`
+				} `xml:"fastSnapshotRestoreStateErrorSet>item"`
+			} `xml:"item"`
+		} `xml:"unsuccessful"`
+	}{}
+	if err := call(sr, action, p, res); err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, item := range res.Unsuccessful.Items {
+		for _, e := range item.Errors {
+			failures = append(failures, fmt.Sprintf("%s: %s %s", e.AvailabilityZone, e.Code, e.Message))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s failed for %s, %s", action, snapshotId, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// DescribeFastSnapshotRestores returns the state of fast snapshot restore of the snapshot in each
+// availability zone where it has been enabled.
+func DescribeFastSnapshotRestores(sr SignedRequester, snapshotId string) ([]FastSnapshotRestore, error) {
+	values := make(url.Values)
+	values.Add("Action", "DescribeFastSnapshotRestores")
+	values.Add("Version", latestAPIVersion)
+	addFilters(values, []Filter{{"snapshot-id", []string{snapshotId}}})
+
+	var restores []FastSnapshotRestore
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set := &struct {
+			RestoreSet struct {
+				Items []FastSnapshotRestore `xml:"item"`
+			} `xml:"fastSnapshotRestoreSet"`
+			NextToken string `xml:"nextToken"`
+		}{}
+		if err := decode(sr, b, set); err != nil {
+			return "", err
+		}
+		restores = append(restores, set.RestoreSet.Items...)
+		return set.NextToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return restores, nil
+}
@@ -0,0 +1,79 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFastSnapshotRestore(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "EnableFastSnapshotRestores":
+			if q.Get("SourceSnapshotId.1") != "snap-1db38de7" || q.Get("AvailabilityZone.2") != "eu-west-1b" {
+				t.Error("Unexpected params", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<EnableFastSnapshotRestoresResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <successful>
+        <item>
+            <snapshotId>snap-1db38de7</snapshotId>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <state>enabling</state>
+        </item>
+    </successful>
+    <unsuccessful>
+        <item>
+            <snapshotId>snap-1db38de7</snapshotId>
+            <fastSnapshotRestoreStateErrorSet>
+                <item>
+                    <availabilityZone>eu-west-1b</availabilityZone>
+                    <error>
+                        <code>FastSnapshotRestoreLimitExceeded</code>
+                        <message>Limit exceeded</message>
+                    </error>
+                </item>
+            </fastSnapshotRestoreStateErrorSet>
+        </item>
+    </unsuccessful>
+</EnableFastSnapshotRestoresResponse>`)
+		case "DescribeFastSnapshotRestores":
+			if q.Get("Filter.1.Name") != "snapshot-id" || q.Get("Filter.1.Value.1") != "snap-1db38de7" {
+				t.Error("Expected snapshot-id filter, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeFastSnapshotRestoresResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <fastSnapshotRestoreSet>
+        <item>
+            <snapshotId>snap-1db38de7</snapshotId>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <state>optimizing</state>
+            <stateTransitionReason>Client.UserInitiated - Lifecycle state transition</stateTransitionReason>
+        </item>
+    </fastSnapshotRestoreSet>
+</DescribeFastSnapshotRestoresResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	err := EnableFastSnapshotRestore(sr, "snap-1db38de7", []string{"eu-west-1a", "eu-west-1b"})
+	if e := "EnableFastSnapshotRestores failed for snap-1db38de7, eu-west-1b: FastSnapshotRestoreLimitExceeded Limit exceeded"; err == nil || err.Error() != e {
+		t.Error("Expected the failed zone to be reported, got", err)
+	}
+
+	restores, err := DescribeFastSnapshotRestores(sr, "snap-1db38de7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restores) != 1 || restores[0].AvailabilityZone != "eu-west-1a" || restores[0].State != FastRestoreOptimizing {
+		t.Error("Unexpected fast snapshot restores", restores)
+	}
+}
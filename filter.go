@@ -0,0 +1,116 @@
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Filter narrows down the result of a Describe* request, see the EC2 API reference for the names
+// supported by each action. A resource matches when it matches any of the values of every filter.
+type Filter struct {
+	Name   string
+	Values []string
+}
+
+// TagFilters returns the filters matching resources having all of the specified tags.
+func TagFilters(tags []TagItem) []Filter {
+	filters := make([]Filter, len(tags))
+	for n, tag := range tags {
+		filters[n] = Filter{"tag:" + tag.Key, []string{tag.Value}}
+	}
+	return filters
+}
+
+func addFilters(values paramSetter, filters []Filter) {
+	for n, filter := range filters {
+		values.Set(fmt.Sprintf("Filter.%d.Name", n+1), filter.Name)
+		for m, value := range filter.Values {
+			values.Set(fmt.Sprintf("Filter.%d.Value.%d", n+1, m+1), value)
+		}
+	}
+}
+
+// ListOption modifies the behaviour of the lookups returning several resources.
+type ListOption func(*listConfig)
+
+type listConfig struct {
+	limit    int
+	pageSize int
+}
+
+// defaultPageSize is the number of results asked for per page when no PageSize is given.
+const defaultPageSize = 500
+
+// Limit stops the lookup once n resources have been found instead of following every page, e.g. a limit of
+// 2 is enough to tell whether a name is unique.
+func Limit(n int) ListOption {
+	return func(c *listConfig) {
+		c.limit = n
+	}
+}
+
+// PageSize sets how many results Amazon returns per page, clamped to the range the action supports,
+// defaults to 500. Large pages mean fewer but slower requests, very small pages multiply the number of
+// requests and with it the risk of being throttled.
+func PageSize(n int) ListOption {
+	return func(c *listConfig) {
+		c.pageSize = n
+	}
+}
+
+// newListConfig applies the options and sets MaxResults when the action supports it up to maxResults, zero
+// meaning it doesn't. No more results per page than needed for the limit are asked for.
+func newListConfig(values url.Values, maxResults int, opts []ListOption) *listConfig {
+	c := &listConfig{pageSize: defaultPageSize}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if maxResults > 0 {
+		n := c.pageSize
+		if c.limit > 0 && c.limit < n {
+			n = c.limit
+		}
+		// Amazon rejects pages smaller than 5 results.
+		if n < 5 {
+			n = 5
+		} else if n > maxResults {
+			n = maxResults
+		}
+		values.Set("MaxResults", strconv.Itoa(n))
+	}
+	return c
+}
+
+// next returns the token to continue with after count resources have been collected.
+func (c *listConfig) next(count int, token string) string {
+	if c.limit > 0 && count >= c.limit {
+		return ""
+	}
+	return token
+}
+
+// truncate returns the number of resources to keep out of count.
+func (c *listConfig) truncate(count int) int {
+	if c.limit > 0 && count > c.limit {
+		return c.limit
+	}
+	return count
+}
+
+// maxFilterValues is the number of values Amazon accepts for a single filter.
+const maxFilterValues = 200
+
+// chunkValues splits values into chunks of at most size values, e.g. to look up more ids than a single
+// request accepts.
+func chunkValues(values []string, size int) [][]string {
+	var chunks [][]string
+	for len(values) > size {
+		chunks = append(chunks, values[:size])
+		values = values[size:]
+	}
+	if len(values) > 0 {
+		chunks = append(chunks, values)
+	}
+	return chunks
+}
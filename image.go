@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"net/url"
+)
+
+type Image struct {
+	Id                 string `xml:"imageId"`
+	Name               string `xml:"name"`
+	State              string `xml:"imageState"`
+	BlockDeviceMapping struct {
+		Items []struct {
+			Device string `xml:"deviceName"`
+			Ebs    struct {
+				SnapshotId string `xml:"snapshotId"`
+			} `xml:"ebs"`
+		} `xml:"item"`
+	} `xml:"blockDeviceMapping"`
+}
+
+// ImagesByFilter will return the images owned by us matching the filters.
+func ImagesByFilter(sr SignedRequester, filters []Filter, opts ...ListOption) ([]Image, error) {
+	values := make(url.Values)
+	values.Add("Action", "DescribeImages")
+	values.Add("Owner.1", "self")
+	addFilters(values, filters)
+	// MaxResults requires a newer API version for DescribeImages, limit client side only.
+	list := newListConfig(values, 0, opts)
+
+	var images []Image
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set := &struct {
+			ImagesSet struct {
+				Items []Image `xml:"item"`
+			} `xml:"imagesSet"`
+			NextToken string `xml:"nextToken"`
+		}{}
+		if err := decode(sr, b, set); err != nil {
+			return "", err
+		}
+		images = append(images, set.ImagesSet.Items...)
+		return list.next(len(images), set.NextToken), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return images[:list.truncate(len(images))], nil
+}
+
+// imagesBySnapshot returns the ids of our images referencing each of the snapshots.
+func imagesBySnapshot(sr SignedRequester, snapshots []string) (map[string][]string, error) {
+	refs := make(map[string][]string)
+	if len(snapshots) == 0 {
+		return refs, nil
+	}
+
+	for _, chunk := range chunkValues(snapshots, maxFilterValues) {
+		images, err := ImagesByFilter(sr, []Filter{{"block-device-mapping.snapshot-id", chunk}})
+		if err != nil {
+			return nil, err
+		}
+		// Images referencing snapshots of several chunks are found once for each of them, only the snapshots
+		// of this chunk are recorded so that the image isn't listed twice.
+		inChunk := make(map[string]bool, len(chunk))
+		for _, id := range chunk {
+			inChunk[id] = true
+		}
+		for _, image := range images {
+			for _, item := range image.BlockDeviceMapping.Items {
+				if id := item.Ebs.SnapshotId; inChunk[id] {
+					refs[id] = append(refs[id], image.Id)
+				}
+			}
+		}
+	}
+	return refs, nil
+}
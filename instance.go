@@ -0,0 +1,194 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type InstanceState string
+
+// pending | running | shutting-down | terminated | stopping | stopped
+var (
+	InstancePending      InstanceState = "pending"
+	InstanceRunning      InstanceState = "running"
+	InstanceShuttingDown InstanceState = "shutting-down"
+	InstanceTerminated   InstanceState = "terminated"
+	InstanceStopping     InstanceState = "stopping"
+	InstanceStopped      InstanceState = "stopped"
+)
+
+func (s InstanceState) String() string {
+	return string(s)
+}
+
+type Instance struct {
+	Id    string `xml:"instanceId"`
+	VpcId string `xml:"vpcId"`
+	State struct {
+		Code int           `xml:"code"`
+		Name InstanceState `xml:"name"`
+	} `xml:"instanceState"`
+	Placement struct {
+		AvailabilityZone string `xml:"availabilityZone"`
+	} `xml:"placement"`
+	RootDeviceName     string `xml:"rootDeviceName"`
+	BlockDeviceMapping struct {
+		Items []DeviceMapping `xml:"item"`
+	} `xml:"blockDeviceMapping"`
+	TagSet struct {
+		Items []TagItem `xml:"item"`
+	} `xml:"tagSet"`
+}
+
+type InstanceReservationSet struct {
+	ReservationSet struct {
+		Items []struct {
+			InstancesSet struct {
+				Items []Instance `xml:"item"`
+			} `xml:"instancesSet"`
+		} `xml:"item"`
+	} `xml:"reservationSet"`
+	NextToken string `xml:"nextToken"`
+}
+
+// Instances flattens the instances of every reservation in the set.
+func (s *InstanceReservationSet) Instances() []Instance {
+	var instances []Instance
+	for _, reservation := range s.ReservationSet.Items {
+		instances = append(instances, reservation.InstancesSet.Items...)
+	}
+	return instances
+}
+
+// InstanceById will return the instance that matches the specified id.
+func InstanceById(sr SignedRequester, id string) (*Instance, error) {
+	set := new(InstanceReservationSet)
+	if err := call(sr, "DescribeInstances", params{"InstanceId.1": id}, set); err != nil {
+		return nil, err
+	}
+
+	instances := set.Instances()
+	if err := expectOne("instance", id, len(instances)); err != nil {
+		return nil, err
+	}
+	return &instances[0], nil
+}
+
+// InstancesByFilter will return the instances of every reservation matching the filters, following pagination.
+// Filters such as instance-state-name and tags are combined, e.g. to find the stopped instances of a role.
+func InstancesByFilter(sr SignedRequester, filters []Filter, opts ...ListOption) ([]Instance, error) {
+	values := make(url.Values)
+	values.Add("Action", "DescribeInstances")
+	addFilters(values, filters)
+	list := newListConfig(values, 1000, opts)
+
+	var instances []Instance
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set := new(InstanceReservationSet)
+		if err := decode(sr, b, set); err != nil {
+			return "", err
+		}
+		instances = append(instances, set.Instances()...)
+		return list.next(len(instances), set.NextToken), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instances[:list.truncate(len(instances))], nil
+}
+
+// RebootInstances requests a reboot of the instances. The request returns once the reboot is queued, use
+// WaitForInstanceState to confirm that an instance is running afterwards.
+func RebootInstances(sr SignedRequester, ids ...string) error {
+	p := make(params)
+	for n, id := range ids {
+		p.Set(fmt.Sprintf("InstanceId.%d", n+1), id)
+	}
+
+	return call(sr, "RebootInstances", p, nil)
+}
+
+// InstanceSecurityGroups returns the ids of the security groups the instance belongs to.
+func InstanceSecurityGroups(sr SignedRequester, instance string) ([]string, error) {
+	m := &struct {
+		Groups struct {
+			Items []struct {
+				Id string `xml:"groupId"`
+			} `xml:"item"`
+		} `xml:"groupSet"`
+	}{}
+	if err := call(sr, "DescribeInstanceAttribute", params{"InstanceId": instance, "Attribute": "groupSet"}, m); err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, len(m.Groups.Items))
+	for n, item := range m.Groups.Items {
+		groups[n] = item.Id
+	}
+	return groups, nil
+}
+
+// InstanceUserData returns the decoded user data of the instance, or an empty string if it has none.
+func InstanceUserData(sr SignedRequester, instance string) (string, error) {
+	m := &struct {
+		Value string `xml:"userData>value"`
+	}{}
+	if err := call(sr, "DescribeInstanceAttribute", params{"InstanceId": instance, "Attribute": "userData"}, m); err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(m.Value)
+	if err != nil {
+		return "", fmt.Errorf("Could not decode user data of %s: %s", instance, err)
+	}
+	return string(data), nil
+}
+
+// ConsoleOutput returns the decoded console output of the instance, or an empty string if it isn't available yet.
+func ConsoleOutput(sr SignedRequester, instance string) (string, error) {
+	m := &struct {
+		Output string `xml:"output"`
+	}{}
+	if err := call(sr, "GetConsoleOutput", params{"InstanceId": instance}, m); err != nil {
+		return "", err
+	}
+
+	output, err := base64.StdEncoding.DecodeString(m.Output)
+	if err != nil {
+		return "", fmt.Errorf("Could not decode console output of %s: %s", instance, err)
+	}
+	return string(output), nil
+}
+
+// PasswordData returns the base64 encoded administrator password of a Windows instance, encrypted with its key
+// pair, or an empty string if it isn't available yet. Decrypting it is left to the caller.
+func PasswordData(sr SignedRequester, instance string) (string, error) {
+	m := &struct {
+		PasswordData string `xml:"passwordData"`
+	}{}
+	if err := call(sr, "GetPasswordData", params{"InstanceId": instance}, m); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(m.PasswordData), nil
+}
+
+// SetInstanceSecurityGroups replaces the security groups of a VPC instance with the specified groups.
+func SetInstanceSecurityGroups(sr SignedRequester, instance string, groups []string) error {
+	inst, err := InstanceById(sr, instance)
+	if err != nil {
+		return err
+	}
+	if inst.VpcId == "" {
+		return fmt.Errorf("Security groups can only be changed for VPC instances, %s is EC2-Classic", instance)
+	}
+
+	p := params{"InstanceId": instance}
+	for n, group := range groups {
+		p.Set(fmt.Sprintf("GroupId.%d", n+1), group)
+	}
+
+	return call(sr, "ModifyInstanceAttribute", p, nil)
+}
@@ -0,0 +1,263 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetInstanceSecurityGroups(t *testing.T) {
+	vpcId := "<vpcId>vpc-1a2b3c4d</vpcId>"
+	modified := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeInstances":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    %s
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`, vpcId)
+		case "ModifyInstanceAttribute":
+			modified = true
+			if q.Get("GroupId.1") != "sg-1a2b3c4d" || q.Get("GroupId.2") != "sg-9d8e7f6a" {
+				t.Error("Expected GroupId.N parameters, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ModifyInstanceAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <return>true</return>
+</ModifyInstanceAttributeResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := SetInstanceSecurityGroups(sr, "i-7ae3b239", []string{"sg-1a2b3c4d", "sg-9d8e7f6a"}); err != nil {
+		t.Error(err)
+	}
+	if !modified {
+		t.Error("Expected ModifyInstanceAttribute to be called")
+	}
+
+	vpcId, modified = "", false
+	if err := SetInstanceSecurityGroups(sr, "i-7ae3b239", []string{"sg-1a2b3c4d"}); err == nil {
+		t.Error("Expected an error for EC2-Classic instance")
+	}
+	if modified {
+		t.Error("Expected no modification of EC2-Classic instance")
+	}
+}
+
+func TestInstanceUserData(t *testing.T) {
+	userData := "<userData><value>IyEvYmluL3NoCmVjaG8gaGVsbG8K</value></userData>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeInstanceAttribute" || q.Get("Attribute") != "userData" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstanceAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <instanceId>i-7ae3b239</instanceId>
+    %s
+</DescribeInstanceAttributeResponse>`, userData)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	data, err := InstanceUserData(sr, "i-7ae3b239")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := "#!/bin/sh\necho hello\n"; data != e {
+		t.Errorf("Expected user data to be %q, got %q", e, data)
+	}
+
+	userData = "<userData/>"
+	if data, err := InstanceUserData(sr, "i-7ae3b239"); err != nil || data != "" {
+		t.Errorf("Expected empty user data without error, got %q, %v", data, err)
+	}
+}
+
+func TestRebootInstances(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "RebootInstances" || q.Get("InstanceId.1") != "i-7ae3b239" {
+			t.Error("Unexpected request", q)
+		}
+		if q.Get("InstanceId.2") != "i-1a2b3c4d" {
+			w.WriteHeader(400)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    <Errors>
+        <Error>
+            <Code>InvalidInstanceID.Malformed</Code>
+            <Message>Invalid id: "i-bogus"</Message>
+        </Error>
+    </Errors>
+    <RequestID>ea966190-f9aa-478e-9ede-example</RequestID>
+</Response>`)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<RebootInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <return>true</return>
+</RebootInstancesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := RebootInstances(sr, "i-7ae3b239", "i-1a2b3c4d"); err != nil {
+		t.Error(err)
+	}
+	if err := RebootInstances(sr, "i-7ae3b239", "i-bogus"); ErrorCode(err) != "InvalidInstanceID.Malformed" {
+		t.Error("Expected the error of Amazon, got", err)
+	}
+}
+
+func TestConsoleOutput(t *testing.T) {
+	output := "<output>TGludXggdmVyc2lvbiAyLjYuMTYteGVuVSAoYnVpbGRlckBwYXRjaGJhdC5hbWF6b25zYSkK</output>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); q.Get("Action") != "GetConsoleOutput" || q.Get("InstanceId") != "i-7ae3b239" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<GetConsoleOutputResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <instanceId>i-7ae3b239</instanceId>
+    <timestamp>2014-10-06T11:43:23.000Z</timestamp>
+    %s
+</GetConsoleOutputResponse>`, output)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	text, err := ConsoleOutput(sr, "i-7ae3b239")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := "Linux version 2.6.16-xenU (builder@patchbat.amazonsa)\n"; text != e {
+		t.Errorf("Expected console output %q, got %q", e, text)
+	}
+
+	output = ""
+	if text, err := ConsoleOutput(sr, "i-7ae3b239"); err != nil || text != "" {
+		t.Errorf("Expected no output without error, got %q, %v", text, err)
+	}
+}
+
+func TestPasswordData(t *testing.T) {
+	password := "TGludXggdmVyc2lvbiAyLjYuMTYteGVuVSAoYnVpbGRlckBwYXRjaGJhdC5hbWF6b25zYSkK"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); q.Get("Action") != "GetPasswordData" || q.Get("InstanceId") != "i-2574e22a" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<GetPasswordDataResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <instanceId>i-2574e22a</instanceId>
+    <timestamp>2014-10-06T11:43:23.000Z</timestamp>
+    <passwordData>%s</passwordData>
+</GetPasswordDataResponse>`, password)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if data, err := PasswordData(sr, "i-2574e22a"); err != nil || data != password {
+		t.Errorf("Expected password data %q, got %q, %v", password, data, err)
+	}
+
+	password = ""
+	if data, err := PasswordData(sr, "i-2574e22a"); err != nil || data != "" {
+		t.Errorf("Expected no password data without error, got %q, %v", data, err)
+	}
+}
+
+func TestInstancesByFilter(t *testing.T) {
+	pages := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeInstances" {
+			t.Error("Unexpected action", q.Get("Action"))
+		}
+		if q.Get("Filter.1.Name") != "instance-state-name" || q.Get("Filter.1.Value.1") != "stopped" ||
+			q.Get("Filter.2.Name") != "tag:role" || q.Get("Filter.2.Value.1") != "worker" {
+			t.Error("Expected state and tag filters, got", q)
+		}
+		pages++
+		if q.Get("NextToken") == "" {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <reservationId>r-1a2b3c4d</reservationId>
+            <instancesSet>
+                <item>
+                    <instanceId>i-7ae3b239</instanceId>
+                    <instanceState><code>80</code><name>stopped</name></instanceState>
+                </item>
+                <item>
+                    <instanceId>i-2574e22a</instanceId>
+                    <instanceState><code>80</code><name>stopped</name></instanceState>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+    <nextToken>page2</nextToken>
+</DescribeInstancesResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <reservationSet>
+        <item>
+            <reservationId>r-5e6f7a8b</reservationId>
+            <instancesSet>
+                <item>
+                    <instanceId>i-10a64379</instanceId>
+                    <instanceState><code>80</code><name>stopped</name></instanceState>
+                </item>
+            </instancesSet>
+        </item>
+    </reservationSet>
+</DescribeInstancesResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	filters := append([]Filter{{"instance-state-name", []string{"stopped"}}}, TagFilters([]TagItem{{"role", "worker"}})...)
+	instances, err := InstancesByFilter(sr, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 {
+		t.Error("Expected both pages to be requested, got", pages)
+	}
+	if len(instances) != 3 || instances[0].Id != "i-7ae3b239" || instances[2].Id != "i-10a64379" {
+		t.Error("Expected the instances of both reservations, got", instances)
+	}
+	for _, instance := range instances {
+		if instance.State.Name != InstanceStopped {
+			t.Errorf("Expected %s to be stopped, got %s", instance.Id, instance.State.Name)
+		}
+	}
+}
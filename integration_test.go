@@ -2,9 +2,7 @@ package aws
 
 import (
 	"flag"
-	"log"
 	"net/http"
-	"net/http/httputil"
 	"testing"
 )
 
@@ -15,27 +13,15 @@ var (
 	volume      = flag.String("volume", "vol-9d351996", "Volume id to run experiments with")
 	snapshot    = flag.String("snapshot", "snap-1db38de7", "Snapshot id to run experiments with")
 	endpoint    = flag.String("endpoint", "https://ec2.eu-west-1.amazonaws.com", "AWS Endpoint to use")
+	localstack  = flag.String("localstack", "", "LocalStack endpoint to test against, e.g. http://localhost:4566")
 )
 
 func init() {
 	flag.Parse()
 }
 
-type loggingTransport struct {
-	*http.Transport
-}
-
-func newLoggingTransport() *loggingTransport {
-	return &loggingTransport{&http.Transport{}}
-}
-
-func (l *loggingTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-	b, _ := httputil.DumpRequest(req, true)
-	log.Println("\n" + string(b))
-	resp, err = l.Transport.RoundTrip(req)
-	b, _ = httputil.DumpResponse(resp, true)
-	log.Println("\n" + string(b))
-	return
+func newLoggingTransport() *LoggingTransport {
+	return &LoggingTransport{Transport: &http.Transport{}}
 }
 
 func TestVolumeByTagsIntegration(t *testing.T) {
@@ -204,3 +190,30 @@ func TestAssociateAddressIntegration(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestLocalStack(t *testing.T) {
+	if *localstack == "" {
+		t.Skip("LocalStack tests not enabled")
+		return
+	}
+
+	// LocalStack accepts any credentials but uses the signing region to pick its simulated region.
+	signer := NewV4Signer(Credentials{AccessKeyId: "test", SecretAccessKey: "test"}, WithSigningRegion("eu-west-1"))
+	client := &http.Client{Transport: newLoggingTransport()}
+	sr := NewSignedRequester(client, *localstack, signer)
+
+	vol, err := CreateVolume(sr, 1, 0, false, "eu-west-1a", "", []TagItem{TagItem{"Stack", "joonix-testing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VolumeById(sr, vol.Id); err != nil {
+		t.Error(err)
+	}
+	if err := DeleteVolume(sr, vol.Id); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := VolumeById(sr, "vol-ffffffff"); err != ErrNotFound && ErrorCode(err) != "InvalidVolume.NotFound" {
+		t.Error("Expected volume to be missing, got", err)
+	}
+}
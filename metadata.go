@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetadataClient reads the instance metadata service of EC2, using IMDSv2 session tokens when available
+// and falling back to IMDSv1 otherwise.
+type MetadataClient struct {
+	// Endpoint of the metadata service, defaults to http://169.254.169.254.
+	Endpoint string
+	// Client defaults to one with a short timeout, so that requests fail fast when not running on EC2.
+	Client *http.Client
+	// TokenTTL is how long session tokens are valid, defaults to six hours.
+	TokenTTL time.Duration
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewMetadataClient returns a client for the metadata service of the instance we are running on.
+func NewMetadataClient() *MetadataClient {
+	return &MetadataClient{
+		Endpoint: "http://169.254.169.254",
+		Client:   &http.Client{Timeout: time.Second},
+		TokenTTL: 6 * time.Hour,
+	}
+}
+
+// GetContext returns the metadata at the path relative to /latest/meta-data/, e.g. "instance-id".
+func (m *MetadataClient) GetContext(ctx context.Context, path string) (string, error) {
+	token := m.sessionToken(ctx, false)
+	res, err := m.get(ctx, path, token)
+	if err == nil && res.StatusCode == http.StatusUnauthorized && token != "" {
+		// The token was rejected before it expired, e.g. after the instance was stopped.
+		res.Body.Close()
+		res, err = m.get(ctx, path, m.sessionToken(ctx, true))
+	}
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Could not get metadata %s, got status %d", path, res.StatusCode)
+	}
+	return string(b), nil
+}
+
+func (m *MetadataClient) get(ctx context.Context, path, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", m.endpoint()+"/latest/meta-data/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	return m.client().Do(req.WithContext(ctx))
+}
+
+// sessionToken returns a cached IMDSv2 token, requesting a new one when it expired or renew is set.
+// An empty token is returned when none could be obtained so that IMDSv1 is used.
+func (m *MetadataClient) sessionToken(ctx context.Context, renew bool) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !renew && m.token != "" && time.Now().Before(m.expires) {
+		return m.token
+	}
+	m.token = ""
+
+	ttl := m.TokenTTL
+	if ttl <= 0 {
+		ttl = 6 * time.Hour
+	}
+	req, err := http.NewRequest("PUT", m.endpoint()+"/latest/api/token", nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(int(ttl/time.Second)))
+
+	res, err := m.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return ""
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return ""
+	}
+	// Renew a minute early to not use a token expiring during a request.
+	m.token, m.expires = string(b), time.Now().Add(ttl-time.Minute)
+	return m.token
+}
+
+func (m *MetadataClient) endpoint() string {
+	if m.Endpoint == "" {
+		return "http://169.254.169.254"
+	}
+	return strings.TrimSuffix(m.Endpoint, "/")
+}
+
+func (m *MetadataClient) client() *http.Client {
+	if m.Client == nil {
+		return &http.Client{Timeout: time.Second}
+	}
+	return m.Client
+}
@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadataClientIMDSv2(t *testing.T) {
+	tokens := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			if ttl := r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"); ttl != "21600" {
+				t.Error("Expected token TTL of six hours, got", ttl)
+			}
+			tokens++
+			fmt.Fprintf(w, "token-%d", tokens)
+		case r.Method == "GET" && r.URL.Path == "/latest/meta-data/instance-id":
+			if r.Header.Get("X-aws-ec2-metadata-token") != fmt.Sprintf("token-%d", tokens) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "i-7ae3b239")
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	m := NewMetadataClient()
+	m.Endpoint = ts.URL
+
+	for n := 0; n < 2; n++ {
+		if id, err := m.GetContext(context.Background(), "instance-id"); err != nil || id != "i-7ae3b239" {
+			t.Error("Expected instance id, got", id, err)
+		}
+	}
+	if tokens != 1 {
+		t.Error("Expected the token to be reused, requested", tokens)
+	}
+
+	// A rejected token is replaced.
+	tokens++
+	if id, err := m.GetContext(context.Background(), "instance-id"); err != nil || id != "i-7ae3b239" {
+		t.Error("Expected instance id with a new token, got", id, err)
+	}
+}
+
+func TestMetadataClientIMDSv1(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if token := r.Header.Get("X-aws-ec2-metadata-token"); token != "" {
+			t.Error("Expected no token, got", token)
+		}
+		if r.URL.Path != "/latest/meta-data/placement/availability-zone" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "eu-west-1a")
+	}))
+	defer ts.Close()
+
+	m := NewMetadataClient()
+	m.Endpoint = ts.URL
+
+	if az, err := m.GetContext(context.Background(), "placement/availability-zone"); err != nil || az != "eu-west-1a" {
+		t.Error("Expected availability zone, got", az, err)
+	}
+	if _, err := m.GetContext(context.Background(), "missing"); err == nil {
+		t.Error("Expected missing metadata to fail")
+	}
+}
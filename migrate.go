@@ -0,0 +1,72 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+)
+
+// MigrateVolumeToAZ moves an unattached volume to another availability zone by creating a snapshot of it and a
+// new volume of the same type, provisioned IOPS and throughput from the snapshot, with multi-attach enabled if it
+// was for the source volume. The new volume keeps the tags of the source volume, except those reserved by AWS,
+// with the specified tags added or replacing those with the same key. Once the new volume is available the source
+// volume and the snapshot are deleted. If any step fails, what was created so far is deleted and the source volume
+// is left as it was. The new volume is returned even when only deleting the snapshot failed.
+func MigrateVolumeToAZ(ctx context.Context, sr SignedRequester, id, az string, tags []TagItem) (*EbsVolume, error) {
+	src, err := VolumeById(sr, id)
+	if err != nil {
+		return nil, err
+	}
+	if src.Status != VolumeAvailable {
+		return nil, fmt.Errorf("Volume %s has to be available to be migrated, it is %s", id, src.Status)
+	}
+
+	snap, err := CreateSnapshot(sr, id, fmt.Sprintf("Migrating %s from %s to %s", id, src.AvailabilityZone, az))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := WaitForSnapshotStatus(ctx, sr, snap.Id, SnapshotCompleted, nil); err != nil {
+		DeleteSnapshot(sr, snap.Id)
+		return nil, err
+	}
+
+	// The tags were described along with the volume, sparing the lookup of CopyTags.
+	tags = mergeTags(copyableTags(src.TagSet.Items), tags)
+	vol, err := CreateVolumeSpec(sr, VolumeSpec{
+		Size:        src.Size,
+		VolumeType:  src.VolumeType,
+		Iops:        src.provisionedIops(),
+		Throughput:  src.Throughput,
+		AZ:          az,
+		SnapshotId:  snap.Id,
+		Tags:        tags,
+		MultiAttach: src.MultiAttach,
+	})
+	if err != nil {
+		DeleteSnapshot(sr, snap.Id)
+		return nil, err
+	}
+	created := vol.Id
+	if vol, err = WaitForVolumeStatus(ctx, sr, created, VolumeAvailable, nil); err == nil {
+		err = DeleteVolume(sr, id)
+	}
+	if err != nil {
+		DeleteVolume(sr, created)
+		DeleteSnapshot(sr, snap.Id)
+		return nil, err
+	}
+
+	if err := DeleteSnapshot(sr, snap.Id); err != nil {
+		return vol, fmt.Errorf("Migrated %s to %s but could not delete snapshot %s: %s", id, vol.Id, snap.Id, err)
+	}
+	return vol, nil
+}
+
+// provisionedIops returns the provisioned IOPS of io1, io2 and gp3 volumes, zero for other types whose IOPS
+// follow from their size.
+func (v *EbsVolume) provisionedIops() uint {
+	switch v.VolumeType {
+	case "io1", "io2", "gp3":
+		return v.Iops
+	}
+	return 0
+}
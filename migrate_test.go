@@ -0,0 +1,157 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMigrateVolumeToAZ(t *testing.T) {
+	var calls []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		action := q.Get("Action")
+		calls = append(calls, action+" "+q.Get("VolumeId")+q.Get("VolumeId.1")+q.Get("SnapshotId")+q.Get("SnapshotId.1"))
+
+		switch action {
+		case "DescribeVolumes":
+			az, status := "eu-west-1a", "available"
+			if q.Get("VolumeId.1") == "vol-842b078f" {
+				az = "eu-west-1b"
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>%s</volumeId>
+            <size>10</size>
+            <availabilityZone>%s</availabilityZone>
+            <status>%s</status>
+            <volumeType>gp2</volumeType>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, q.Get("VolumeId.1"), az, status)
+		case "CreateSnapshot":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateSnapshotResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotId>snap-1db38de7</snapshotId>
+    <volumeId>vol-72d8f579</volumeId>
+    <status>pending</status>
+</CreateSnapshotResponse>`)
+		case "DescribeSnapshots":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>
+        <item>
+            <snapshotId>snap-1db38de7</snapshotId>
+            <volumeId>vol-72d8f579</volumeId>
+            <status>completed</status>
+        </item>
+    </snapshotSet>
+</DescribeSnapshotsResponse>`)
+		case "CreateVolume":
+			if q.Get("SnapshotId") != "snap-1db38de7" || q.Get("AvailabilityZone") != "eu-west-1b" || q.Get("Size") != "10" {
+				t.Error("Unexpected CreateVolume params", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeId>vol-842b078f</volumeId>
+    <availabilityZone>eu-west-1b</availabilityZone>
+    <status>creating</status>
+</CreateVolumeResponse>`)
+		case "DeleteVolume", "DeleteSnapshot":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<%sResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</%sResponse>`, action, action)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+
+	vol, err := MigrateVolumeToAZ(context.Background(), sr, "vol-72d8f579", "eu-west-1b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.Id != "vol-842b078f" || vol.AvailabilityZone != "eu-west-1b" {
+		t.Error("Unexpected migrated volume", vol)
+	}
+
+	e := []string{
+		"DescribeVolumes vol-72d8f579",
+		"CreateSnapshot vol-72d8f579",
+		"DescribeSnapshots snap-1db38de7",
+		"CreateVolume snap-1db38de7",
+		"DescribeVolumes vol-842b078f",
+		"DeleteVolume vol-72d8f579",
+		"DeleteSnapshot snap-1db38de7",
+	}
+	if !reflect.DeepEqual(calls, e) {
+		t.Error("Unexpected calls", calls)
+	}
+}
+
+func TestMigrateVolumeKeepsType(t *testing.T) {
+	// The IOPS of st1 volumes follow from their size and must not be provisioned.
+	for volumeType, iops := range map[string]string{"gp3": "4000", "io2": "10000", "st1": "0"} {
+		// Amazon only describes the throughput of gp3 volumes and multi-attach of io1 and io2 volumes.
+		throughput, multiAttach := "", ""
+		switch volumeType {
+		case "gp3":
+			throughput = "250"
+		case "io2":
+			multiAttach = "true"
+		}
+		var created []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			switch action := q.Get("Action"); action {
+			case "DescribeVolumes":
+				fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>%s</volumeId>
+            <size>500</size>
+            <availabilityZone>eu-west-1a</availabilityZone>
+            <status>available</status>
+            <volumeType>%s</volumeType>
+            <iops>%s</iops>
+            <throughput>%s</throughput>
+            <multiAttachEnabled>%s</multiAttachEnabled>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, q.Get("VolumeId.1"), volumeType, iops, throughput, multiAttach)
+			case "CreateSnapshot":
+				fmt.Fprint(w, `<CreateSnapshotResponse><snapshotId>snap-1db38de7</snapshotId><status>pending</status></CreateSnapshotResponse>`)
+			case "DescribeSnapshots":
+				fmt.Fprint(w, `<DescribeSnapshotsResponse><snapshotSet><item><snapshotId>snap-1db38de7</snapshotId><status>completed</status></item></snapshotSet></DescribeSnapshotsResponse>`)
+			case "CreateVolume":
+				created = append(created, q.Get("VolumeType")+" "+q.Get("Iops")+" "+q.Get("Throughput")+" "+q.Get("MultiAttachEnabled"))
+				fmt.Fprint(w, `<CreateVolumeResponse><volumeId>vol-842b078f</volumeId><status>creating</status></CreateVolumeResponse>`)
+			case "DeleteVolume", "DeleteSnapshot":
+				fmt.Fprintf(w, `<%sResponse><return>true</return></%sResponse>`, action, action)
+			default:
+				t.Errorf("Unexpected action '%s'", action)
+			}
+		}))
+
+		sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+		if _, err := MigrateVolumeToAZ(context.Background(), sr, "vol-72d8f579", "eu-west-1b", nil); err != nil {
+			t.Error(err)
+		}
+		if iops == "0" {
+			iops = ""
+		}
+		if e := []string{volumeType + " " + iops + " " + throughput + " " + multiAttach}; !reflect.DeepEqual(created, e) {
+			t.Errorf("Expected the %s volume to be created as %v, got %v", volumeType, e, created)
+		}
+		ts.Close()
+	}
+}
@@ -0,0 +1,67 @@
+package aws
+
+import (
+	"net/url"
+)
+
+type ModificationState string
+
+// modifying | optimizing | completed | failed
+var (
+	ModificationModifying  ModificationState = "modifying"
+	ModificationOptimizing ModificationState = "optimizing"
+	ModificationCompleted  ModificationState = "completed"
+	ModificationFailed     ModificationState = "failed"
+)
+
+func (s ModificationState) String() string {
+	return string(s)
+}
+
+// VolumeModification describes a change made to a volume using ModifyVolume.
+type VolumeModification struct {
+	VolumeId      string            `xml:"volumeId"`
+	State         ModificationState `xml:"modificationState"`
+	StatusMessage string            `xml:"statusMessage"`
+	OriginalSize  uint              `xml:"originalSize"`
+	TargetSize    uint              `xml:"targetSize"`
+	// The IOPS, throughput in MiB/s and type before and after, zero for settings not applying to the type.
+	OriginalIops       uint   `xml:"originalIops"`
+	TargetIops         uint   `xml:"targetIops"`
+	OriginalThroughput uint   `xml:"originalThroughput"`
+	TargetThroughput   uint   `xml:"targetThroughput"`
+	OriginalVolumeType string `xml:"originalVolumeType"`
+	TargetVolumeType   string `xml:"targetVolumeType"`
+	// Progress of the modification in percent.
+	Progress  uint      `xml:"progress"`
+	StartTime Timestamp `xml:"startTime"`
+	EndTime   Timestamp `xml:"endTime"`
+}
+
+// VolumeModifications returns the modifications made to the volume, following pagination.
+func VolumeModifications(sr SignedRequester, volumeId string) ([]VolumeModification, error) {
+	values := make(url.Values)
+	values.Add("Action", "DescribeVolumesModifications")
+	values.Add("Version", latestAPIVersion)
+	values.Add("VolumeId.1", volumeId)
+
+	var mods []VolumeModification
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set := &struct {
+			ModificationSet struct {
+				Items []VolumeModification `xml:"item"`
+			} `xml:"volumeModificationSet"`
+			NextToken string `xml:"nextToken"`
+		}{}
+		if err := decode(sr, b, set); err != nil {
+			return "", err
+		}
+		mods = append(mods, set.ModificationSet.Items...)
+		return set.NextToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mods, nil
+}
@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVolumeModifications(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeVolumesModifications" || q.Get("Version") != latestAPIVersion || q.Get("VolumeId.1") != "vol-72d8f579" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesModificationsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <volumeModificationSet>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <modificationState>completed</modificationState>
+            <originalSize>10</originalSize>
+            <targetSize>20</targetSize>
+            <originalIops>100</originalIops>
+            <targetIops>4000</targetIops>
+            <originalThroughput>0</originalThroughput>
+            <targetThroughput>250</targetThroughput>
+            <originalVolumeType>gp2</originalVolumeType>
+            <targetVolumeType>gp3</targetVolumeType>
+            <originalMultiAttachEnabled>false</originalMultiAttachEnabled>
+            <targetMultiAttachEnabled>false</targetMultiAttachEnabled>
+            <progress>100</progress>
+            <startTime>2017-02-12T21:33:07.000Z</startTime>
+            <endTime>2017-02-12T21:59:34.000Z</endTime>
+        </item>
+        <item>
+            <volumeId>vol-72d8f579</volumeId>
+            <modificationState>optimizing</modificationState>
+            <originalSize>20</originalSize>
+            <targetSize>50</targetSize>
+            <progress>40</progress>
+            <startTime>2017-03-01T08:00:00.000Z</startTime>
+        </item>
+    </volumeModificationSet>
+</DescribeVolumesModificationsResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	mods, err := VolumeModifications(sr, "vol-72d8f579")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 2 {
+		t.Fatal("Expected two modifications, got", mods)
+	}
+	done := mods[0]
+	if done.State != ModificationCompleted || done.OriginalSize != 10 || done.TargetSize != 20 || done.Progress != 100 {
+		t.Error("Unexpected modification", done)
+	}
+	if done.OriginalIops != 100 || done.TargetIops != 4000 || done.OriginalThroughput != 0 || done.TargetThroughput != 250 {
+		t.Error("Unexpected iops or throughput", done)
+	}
+	if done.OriginalVolumeType != "gp2" || done.TargetVolumeType != "gp3" {
+		t.Error("Unexpected volume types", done)
+	}
+	if e := time.Date(2017, 2, 12, 21, 59, 34, 0, time.UTC); !done.EndTime.Equal(e) {
+		t.Error("Expected end time", e, "got", done.EndTime)
+	}
+	if mods[1].State != ModificationOptimizing || !mods[1].EndTime.IsZero() {
+		t.Error("Expected an ongoing modification, got", mods[1])
+	}
+}
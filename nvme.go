@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Where block devices are looked for, variables to be replaced by tests.
+var (
+	sysBlockDir = "/sys/block"
+	devDir      = "/dev"
+)
+
+// ResolveNvmeDevice returns the path of the device a volume attached to the instance we are running on
+// appears as. On nitro instances volumes show up as e.g. /dev/nvme1n1 regardless of the device requested
+// when attaching, the serial of the NVMe device is the volume id without dash. Otherwise the requested
+// device, or its /dev/xvd* equivalent, is returned if it exists. This is best-effort and Linux only.
+func ResolveNvmeDevice(requestedDevice, volumeId string) (string, error) {
+	serial := strings.Replace(volumeId, "-", "", 1)
+	names, _ := filepath.Glob(filepath.Join(sysBlockDir, "nvme*n*"))
+	for _, name := range names {
+		b, err := ioutil.ReadFile(filepath.Join(name, "device", "serial"))
+		if err == nil && strings.TrimSpace(string(b)) == serial {
+			return filepath.Join(devDir, filepath.Base(name)), nil
+		}
+	}
+
+	if device := existingDevice(requestedDevice); device != "" {
+		return device, nil
+	}
+	return "", fmt.Errorf("Could not find the device of %s requested as %s", volumeId, requestedDevice)
+}
+
+// existingDevice returns the path of the requested device, or its /dev/xvd* equivalent, if either exists.
+func existingDevice(requestedDevice string) string {
+	device := filepath.Join(devDir, filepath.Base(requestedDevice))
+	for _, candidate := range []string{device, strings.Replace(device, "/sd", "/xvd", 1)} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// defaultDevicePoll is how often WaitForDevice checks for the device unless told otherwise.
+const defaultDevicePoll = 500 * time.Millisecond
+
+// WaitForDevice polls until the kernel lists the device of the volume, which may take a few seconds after Amazon
+// reported the volume attached, and returns its path. The device is looked up like ResolveNvmeDevice does, so
+// that the NVMe device is found on nitro instances even without udev rules linking the requested name to it.
+// A poll interval of zero or less uses defaultDevicePoll. It returns the requested device right away on other
+// systems than Linux.
+func WaitForDevice(ctx context.Context, device, volumeId string, poll time.Duration) (string, error) {
+	if runtime.GOOS != "linux" {
+		return device, nil
+	}
+	if poll <= 0 {
+		poll = defaultDevicePoll
+	}
+	for {
+		if path, err := ResolveNvmeDevice(device, volumeId); err == nil {
+			return path, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("Device %s of %s did not appear: %s", device, volumeId, ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestResolveNvmeDevice(t *testing.T) {
+	root, err := ioutil.TempDir("", "nvme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(sys, dev string) { sysBlockDir, devDir = sys, dev }(sysBlockDir, devDir)
+	sysBlockDir, devDir = filepath.Join(root, "sys"), filepath.Join(root, "dev")
+
+	for name, serial := range map[string]string{"nvme0n1": "vol0a1b2c3d4e5f60718", "nvme1n1": "vol72d8f579\n"} {
+		os.MkdirAll(filepath.Join(sysBlockDir, name, "device"), 0755)
+		ioutil.WriteFile(filepath.Join(sysBlockDir, name, "device", "serial"), []byte(serial), 0644)
+	}
+	os.MkdirAll(devDir, 0755)
+	ioutil.WriteFile(filepath.Join(devDir, "xvdg"), nil, 0644)
+
+	if device, err := ResolveNvmeDevice("/dev/sdf", "vol-72d8f579"); err != nil || device != filepath.Join(devDir, "nvme1n1") {
+		t.Error("Expected the NVMe device with the serial of the volume, got", device, err)
+	}
+	if device, err := ResolveNvmeDevice("/dev/sdg", "vol-842b078f"); err != nil || device != filepath.Join(devDir, "xvdg") {
+		t.Error("Expected the xvd device on Xen instances, got", device, err)
+	}
+	if _, err := ResolveNvmeDevice("/dev/sdh", "vol-1a2b3c4d"); err == nil {
+		t.Error("Expected a volume without device to fail")
+	}
+}
+
+func TestWaitForDevice(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("WaitForDevice is a no-op off Linux")
+	}
+	root, err := ioutil.TempDir("", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(sys, dev string) { sysBlockDir, devDir = sys, dev }(sysBlockDir, devDir)
+	sysBlockDir, devDir = filepath.Join(root, "sys"), filepath.Join(root, "dev")
+	os.MkdirAll(devDir, 0755)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ioutil.WriteFile(filepath.Join(devDir, "xvdf"), nil, 0644)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if device, err := WaitForDevice(ctx, "/dev/sdf", "vol-72d8f579", time.Millisecond); err != nil || device != filepath.Join(devDir, "xvdf") {
+		t.Error("Expected the device to appear, got", device, err)
+	}
+
+	// Without udev rules only the NVMe device appears on nitro instances.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		os.MkdirAll(filepath.Join(sysBlockDir, "nvme1n1", "device"), 0755)
+		ioutil.WriteFile(filepath.Join(sysBlockDir, "nvme1n1", "device", "serial"), []byte("vol842b078f"), 0644)
+	}()
+	if device, err := WaitForDevice(ctx, "/dev/sdg", "vol-842b078f", 0); err != nil || device != filepath.Join(devDir, "nvme1n1") {
+		t.Error("Expected the NVMe device to be found, got", device, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := WaitForDevice(ctx, "/dev/sdh", "vol-1a2b3c4d", time.Millisecond); err == nil {
+		t.Error("Expected a missing device to time out")
+	}
+}
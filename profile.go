@@ -0,0 +1,271 @@
+package aws
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// profileSettings are the key value pairs of a profile, merged from the credentials and config files.
+type profileSettings map[string]string
+
+// NewProfileSigner returns a signer using the credentials of a profile in the shared credentials and config
+// files, ~/.aws/credentials and ~/.aws/config unless overridden by AWS_SHARED_CREDENTIALS_FILE and AWS_CONFIG_FILE.
+// An empty profile means AWS_PROFILE, or the default profile. Profiles assuming a role using role_arn and
+// source_profile get temporary credentials from STS, which are renewed before they expire. The options are applied
+// after the region of the profile, e.g. to sign for another service than EC2.
+func NewProfileSigner(profile string, signerOpts ...SignerOption) (Signer, error) {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	profiles, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	settings, ok := profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("Could not find the profile %s", profile)
+	}
+
+	var opts []SignerOption
+	if region := settings["region"]; region != "" {
+		opts = append(opts, WithSigningRegion(region))
+	}
+	opts = append(opts, signerOpts...)
+
+	if settings["role_arn"] == "" {
+		creds, err := staticCredentials(profile, settings)
+		if err != nil {
+			return nil, err
+		}
+		return NewV4Signer(creds, opts...), nil
+	}
+
+	source, err := sourceCredentials(profiles, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+	signer := &roleSigner{
+		source:      source,
+		roleArn:     settings["role_arn"],
+		sessionName: settings["role_session_name"],
+		externalId:  settings["external_id"],
+		opts:        opts,
+	}
+	// Assume the role right away to report misconfigurations.
+	if err := signer.refresh(); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// loadProfiles reads the profiles of both the credentials and config files, missing files are ignored.
+func loadProfiles() (map[string]profileSettings, error) {
+	home, _ := os.UserHomeDir()
+	credsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credsFile == "" {
+		credsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(home, ".aws", "config")
+	}
+
+	profiles := make(map[string]profileSettings)
+	// Profiles in the config file are prefixed by "profile", except for the default profile.
+	if err := parseProfiles(configFile, "profile ", profiles); err != nil {
+		return nil, err
+	}
+	// Settings of the credentials file take precedence.
+	if err := parseProfiles(credsFile, "", profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// parseProfiles adds the sections of the ini file to profiles.
+func parseProfiles(path, prefix string, profiles map[string]profileSettings) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var current profileSettings
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			name = strings.TrimSpace(strings.TrimPrefix(name, prefix))
+			if profiles[name] == nil {
+				profiles[name] = make(profileSettings)
+			}
+			current = profiles[name]
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || current == nil {
+			continue
+		}
+		current[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return scanner.Err()
+}
+
+func staticCredentials(profile string, settings profileSettings) (Credentials, error) {
+	creds := Credentials{
+		AccessKeyId:     settings["aws_access_key_id"],
+		SecretAccessKey: settings["aws_secret_access_key"],
+		SecurityToken:   settings["aws_session_token"],
+	}
+	if creds.AccessKeyId == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("Profile %s has no credentials", profile)
+	}
+	return creds, nil
+}
+
+// sourceCredentials resolves the credentials used to assume the role of the profile, following source profiles
+// that in turn assume roles.
+func sourceCredentials(profiles map[string]profileSettings, profile string, visited []string) (Credentials, error) {
+	for _, v := range visited {
+		if v == profile {
+			return Credentials{}, fmt.Errorf("Profile %s has a cyclic source_profile", profile)
+		}
+	}
+	visited = append(visited, profile)
+
+	name := profiles[profile]["source_profile"]
+	if name == "" {
+		return Credentials{}, fmt.Errorf("Profile %s has role_arn without source_profile", profile)
+	}
+	source, ok := profiles[name]
+	if !ok {
+		return Credentials{}, fmt.Errorf("Could not find the source profile %s of %s", name, profile)
+	}
+
+	if source["role_arn"] == "" || name == profile {
+		return staticCredentials(name, source)
+	}
+	creds, err := sourceCredentials(profiles, name, visited)
+	if err != nil {
+		return creds, err
+	}
+	creds, _, err = assumeRole(creds, source["role_arn"], source["role_session_name"], source["external_id"])
+	return creds, err
+}
+
+// assumeRole requests temporary credentials for the role from STS.
+func assumeRole(creds Credentials, roleArn, sessionName, externalId string) (Credentials, time.Time, error) {
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("joonix-aws-%d", time.Now().Unix())
+	}
+
+	p := params{"RoleArn": roleArn, "RoleSessionName": sessionName}
+	if externalId != "" {
+		p.Set("ExternalId", externalId)
+	}
+
+	res := &struct {
+		Credentials struct {
+			AccessKeyId     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      Timestamp `xml:"Expiration"`
+		} `xml:"AssumeRoleResult>Credentials"`
+	}{}
+	sr := NewSignedRequester(http.DefaultClient, stsEndpoint, NewV4Signer(creds, WithSigningService("sts")), WithVersion(stsAPIVersion))
+	if err := call(sr, "AssumeRole", p, res); err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+
+	c := res.Credentials
+	return Credentials{c.AccessKeyId, c.SecretAccessKey, c.SessionToken}, c.Expiration.Time, nil
+}
+
+// roleSigner signs requests with the temporary credentials of an assumed role, assuming it again when they
+// are about to expire.
+type roleSigner struct {
+	source      Credentials
+	roleArn     string
+	sessionName string
+	externalId  string
+	opts        []SignerOption
+
+	mu      sync.Mutex
+	signer  *V4Signer
+	expires time.Time
+}
+
+func (s *roleSigner) refresh() error {
+	creds, expires, err := assumeRole(s.source, s.roleArn, s.sessionName, s.externalId)
+	if err != nil {
+		return err
+	}
+	s.signer, s.expires = NewV4Signer(creds, s.opts...), expires
+	return nil
+}
+
+// current returns a signer using valid credentials. As Signer can't fail, requests are left unsigned when
+// the role can't be assumed again so that Amazon responds with an error.
+func (s *roleSigner) current() *V4Signer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Now().Add(5 * time.Minute).After(s.expires) {
+		if err := s.refresh(); err != nil {
+			return nil
+		}
+	}
+	return s.signer
+}
+
+func (s *roleSigner) signingRegion() string {
+	return NewV4Signer(Credentials{}, s.opts...).Region
+}
+
+// forRegion keeps the credentials of the role assumed already, the copy assumes it again on its own once they
+// are about to expire.
+func (s *roleSigner) forRegion(region string) Signer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clone := &roleSigner{
+		source:      s.source,
+		roleArn:     s.roleArn,
+		sessionName: s.sessionName,
+		externalId:  s.externalId,
+		opts:        append(append([]SignerOption(nil), s.opts...), WithSigningRegion(region)),
+		expires:     s.expires,
+	}
+	if s.signer != nil {
+		clone.signer = s.signer.forRegion(region).(*V4Signer)
+	}
+	return clone
+}
+
+func (s *roleSigner) Sign(r *http.Request) {
+	if signer := s.current(); signer != nil {
+		signer.Sign(r)
+	}
+}
+
+func (s *roleSigner) SignAt(r *http.Request, t time.Time) {
+	if signer := s.current(); signer != nil {
+		signer.SignAt(r, t)
+	}
+}
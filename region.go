@@ -0,0 +1,84 @@
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Partition is a group of regions sharing DNS suffix and credentials, e.g. the China regions.
+type Partition struct {
+	Name      string
+	DNSSuffix string
+}
+
+var (
+	PartitionAWS      = Partition{"aws", "amazonaws.com"}
+	PartitionChina    = Partition{"aws-cn", "amazonaws.com.cn"}
+	PartitionGovCloud = Partition{"aws-us-gov", "amazonaws.com"}
+)
+
+// KnownRegions lists the regions having an EC2 endpoint.
+var KnownRegions = []string{
+	"us-east-1", "us-east-2", "us-west-1", "us-west-2",
+	"ca-central-1", "sa-east-1",
+	"eu-west-1", "eu-west-2", "eu-west-3", "eu-central-1", "eu-north-1",
+	"ap-south-1", "ap-northeast-1", "ap-northeast-2", "ap-southeast-1", "ap-southeast-2",
+	"cn-north-1", "cn-northwest-1",
+	"us-gov-west-1", "us-gov-east-1",
+}
+
+// ValidateRegion returns an error if the region is not one of KnownRegions, e.g. because of a typo.
+func ValidateRegion(region string) error {
+	for _, r := range KnownRegions {
+		if r == region {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown region %q, expected one of %s", region, strings.Join(KnownRegions, ", "))
+}
+
+// PartitionForRegion returns the partition the region belongs to.
+func PartitionForRegion(region string) Partition {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return PartitionChina
+	case strings.HasPrefix(region, "us-gov-"):
+		return PartitionGovCloud
+	}
+	return PartitionAWS
+}
+
+// EndpointForRegion returns the EC2 endpoint of the region. Requests to it have to be signed for the same
+// region, e.g. using WithSigningRegion, since credentials are scoped to their partition.
+func EndpointForRegion(region string) string {
+	return "https://ec2." + region + "." + PartitionForRegion(region).DNSSuffix
+}
+
+// regionPattern matches the labels of host names that are region names, e.g. ap-southeast-2 or us-gov-west-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]+$`)
+
+// RegionFromEndpoint returns the region of an endpoint using one of the host names of Amazon, e.g.
+// ap-southeast-2 for https://ec2.ap-southeast-2.amazonaws.com. The legacy https://ec2.amazonaws.com is in
+// us-east-1. False is returned for other host names, e.g. of emulators or proxies.
+func RegionFromEndpoint(endpoint string) (string, bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false
+	}
+	host := u.Hostname()
+	if !strings.HasSuffix(host, "."+PartitionAWS.DNSSuffix) && !strings.HasSuffix(host, "."+PartitionChina.DNSSuffix) {
+		return "", false
+	}
+	labels := strings.Split(host, ".")
+	for _, label := range labels {
+		if regionPattern.MatchString(label) {
+			return label, true
+		}
+	}
+	if host == "ec2."+PartitionAWS.DNSSuffix {
+		return "us-east-1", true
+	}
+	return "", false
+}
@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEndpointForRegion(t *testing.T) {
+	endpoints := map[string]string{
+		"eu-west-1":     "https://ec2.eu-west-1.amazonaws.com",
+		"cn-north-1":    "https://ec2.cn-north-1.amazonaws.com.cn",
+		"us-gov-west-1": "https://ec2.us-gov-west-1.amazonaws.com",
+	}
+	for region, e := range endpoints {
+		if endpoint := EndpointForRegion(region); endpoint != e {
+			t.Errorf("Expected endpoint for %s to be %s, got %s", region, e, endpoint)
+		}
+	}
+
+	if p := PartitionForRegion("us-gov-west-1"); p != PartitionGovCloud {
+		t.Error("Expected GovCloud partition, got", p)
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	if err := ValidateRegion("eu-west-1"); err != nil {
+		t.Error("Expected eu-west-1 to be valid, got", err)
+	}
+	for _, region := range []string{"eu-wset-1", "eu-west", "", "ec2.eu-west-1.amazonaws.com"} {
+		if err := ValidateRegion(region); err == nil {
+			t.Errorf("Expected %q to be invalid", region)
+		}
+	}
+}
+
+func TestSigningScopeForPartition(t *testing.T) {
+	req, _ := http.NewRequest("GET", EndpointForRegion("cn-north-1"), nil)
+	testV4Signer(WithSigningRegion("cn-north-1")).Sign(req)
+
+	if a := req.Header.Get("Authorization"); !strings.Contains(a, "/cn-north-1/ec2/aws4_request") {
+		t.Error("Expected credential scope for cn-north-1, got", a)
+	}
+}
+
+func TestRegionFromEndpoint(t *testing.T) {
+	regions := map[string]string{
+		"https://ec2.ap-southeast-2.amazonaws.com":                "ap-southeast-2",
+		"https://ec2.cn-north-1.amazonaws.com.cn/":                "cn-north-1",
+		"https://ec2.us-gov-west-1.amazonaws.com":                 "us-gov-west-1",
+		"https://vpce-0123-abcd.ec2.eu-west-1.vpce.amazonaws.com": "eu-west-1",
+		"https://ec2.amazonaws.com":                               "us-east-1",
+		"https://ebs.eu-north-1.amazonaws.com:443":                "eu-north-1",
+	}
+	for endpoint, e := range regions {
+		if region, ok := RegionFromEndpoint(endpoint); !ok || region != e {
+			t.Errorf("Expected region of %s to be %s, got %q", endpoint, e, region)
+		}
+	}
+
+	for _, endpoint := range []string{"http://localhost:4566", "https://ec2.example.com", "https://eu-west-1.example.com", "::"} {
+		if region, ok := RegionFromEndpoint(endpoint); ok {
+			t.Errorf("Expected no region for %s, got %s", endpoint, region)
+		}
+	}
+}
+
+func TestSigningRegionFromEndpoint(t *testing.T) {
+	signer := testV4Signer()
+	sr := NewSignedRequester(http.DefaultClient, "https://ec2.ap-southeast-2.amazonaws.com", signer)
+	if s := sr.(*awsClient).signer.(*V4Signer); s.Region != "ap-southeast-2" {
+		t.Error("Expected to sign for the region of the endpoint, got", s.Region)
+	}
+	if signer.Region != "us-east-1" {
+		t.Error("Expected the signer given to be left alone, got", signer.Region)
+	}
+
+	local := WithEndpoint(sr, "http://localhost:4566")
+	if s := local.(*awsClient).signer.(*V4Signer); s.Region != "ap-southeast-2" {
+		t.Error("Expected custom host names to keep the region, got", s.Region)
+	}
+	eu := WithEndpoint(sr, EndpointForRegion("eu-west-1"))
+	if s := eu.(*awsClient).signer.(*V4Signer); s.Region != "eu-west-1" {
+		t.Error("Expected to sign for the region of the new endpoint, got", s.Region)
+	}
+}
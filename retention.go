@@ -0,0 +1,110 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PruneSnapshotsByTag deletes the snapshots matching the tags that are older than olderThan, except for the
+// keep most recent ones. Only completed snapshots not used by any of our images are deleted. It is safe to
+// run repeatedly and returns the ids of the snapshots deleted.
+func PruneSnapshotsByTag(ctx context.Context, sr SignedRequester, tags []TagItem, keep int, olderThan time.Duration) ([]string, error) {
+	snaps, err := SnapshotsByTags(sr, tags)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].StartTime.After(snaps[j].StartTime.Time)
+	})
+
+	var candidates []string
+	for n, snap := range snaps {
+		if n < keep || snap.Status != SnapshotCompleted || time.Since(snap.StartTime.Time) <= olderThan {
+			continue
+		}
+		candidates = append(candidates, snap.Id)
+	}
+
+	// Like DeleteSnapshotSafe, but with a single lookup for all of the candidates.
+	refs, err := imagesBySnapshot(sr, candidates)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, id := range candidates {
+		if len(refs[id]) == 0 {
+			ids = append(ids, id)
+		}
+	}
+
+	result := DeleteSnapshots(ctx, sr, ids)
+	if err := result.Err(); err != nil {
+		return result.Succeeded, fmt.Errorf("Could not delete snapshots, %s", err)
+	}
+	return result.Succeeded, nil
+}
+
+// unknownVolumeId is reported as the volume of snapshots whose source volume is unknown, e.g. copies.
+const unknownVolumeId = "vol-ffffffff"
+
+// OrphanedSnapshots returns the snapshots owned by us whose source volume no longer exists, or is unknown,
+// and that no image of ours is based on. They are usually safe to delete to save storage costs.
+func OrphanedSnapshots(sr SignedRequester) ([]EbsSnapshot, error) {
+	snaps, err := SnapshotsByFilter(sr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var volumeIds []string
+	seen := make(map[string]bool)
+	for _, snap := range snaps {
+		if id := snap.VolumeId; id != "" && id != unknownVolumeId && !seen[id] {
+			seen[id] = true
+			volumeIds = append(volumeIds, id)
+		}
+	}
+	// Unlike looking up the ids directly, filtering by them doesn't fail when some of the volumes are gone.
+	existing := make(map[string]bool)
+	for _, chunk := range chunkValues(volumeIds, maxFilterValues) {
+		vols, err := VolumesByFilter(sr, []Filter{{"volume-id", chunk}})
+		if err != nil {
+			return nil, err
+		}
+		for _, vol := range vols {
+			existing[vol.Id] = true
+		}
+	}
+
+	var candidates []string
+	for _, snap := range snaps {
+		if !existing[snap.VolumeId] {
+			candidates = append(candidates, snap.Id)
+		}
+	}
+	refs, err := imagesBySnapshot(sr, candidates)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []EbsSnapshot
+	for _, snap := range snaps {
+		if !existing[snap.VolumeId] && len(refs[snap.Id]) == 0 {
+			orphans = append(orphans, snap)
+		}
+	}
+	return orphans, nil
+}
+
+// DeleteSnapshotSafe deletes the snapshot unless images are based on it, in which case a SnapshotInUseError
+// listing them is returned rather than the opaque InvalidSnapshot.InUse error of DeleteSnapshot.
+func DeleteSnapshotSafe(sr SignedRequester, snapshotId string) error {
+	refs, err := imagesBySnapshot(sr, []string{snapshotId})
+	if err != nil {
+		return err
+	}
+	if images := refs[snapshotId]; len(images) > 0 {
+		return &SnapshotInUseError{snapshotId, images}
+	}
+	return DeleteSnapshot(sr, snapshotId)
+}
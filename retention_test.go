@@ -0,0 +1,218 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPruneSnapshotsByTag(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeSnapshots":
+			if q.Get("Owner.1") != "self" || q.Get("Filter.1.Name") != "tag:Backup" || q.Get("Filter.1.Value.1") != "db" {
+				t.Error("Unexpected DescribeSnapshots params", q)
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>
+        <item><snapshotId>snap-old</snapshotId><status>completed</status><startTime>2014-09-01T11:43:23.000Z</startTime></item>
+        <item><snapshotId>snap-newest</snapshotId><status>completed</status><startTime>2014-10-06T11:43:23.000Z</startTime></item>
+        <item><snapshotId>snap-recent</snapshotId><status>completed</status><startTime>%s</startTime></item>
+        <item><snapshotId>snap-ami</snapshotId><status>completed</status><startTime>2014-09-02T11:43:23.000Z</startTime></item>
+        <item><snapshotId>snap-pending</snapshotId><status>pending</status><startTime>2014-09-03T11:43:23.000Z</startTime></item>
+    </snapshotSet>
+</DescribeSnapshotsResponse>`, recent)
+		case "DescribeImages":
+			if q.Get("Filter.1.Name") != "block-device-mapping.snapshot-id" || len(q["Filter.1.Value.3"]) != 0 {
+				t.Error("Unexpected DescribeImages params", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeImagesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <imagesSet>
+        <item>
+            <imageId>ami-1a2b3c4d</imageId>
+            <imageState>available</imageState>
+            <blockDeviceMapping>
+                <item><deviceName>/dev/sda1</deviceName><ebs><snapshotId>snap-ami</snapshotId></ebs></item>
+            </blockDeviceMapping>
+        </item>
+    </imagesSet>
+</DescribeImagesResponse>`)
+		case "DeleteSnapshot":
+			deleted = append(deleted, q.Get("SnapshotId"))
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DeleteSnapshotResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</DeleteSnapshotResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	ids, err := PruneSnapshotsByTag(context.Background(), sr, []TagItem{{"Backup", "db"}}, 2, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"snap-old"}) || !reflect.DeepEqual(deleted, ids) {
+		t.Error("Expected only the old unreferenced snapshot to be deleted, got", ids, deleted)
+	}
+}
+
+func TestDeleteSnapshotSafe(t *testing.T) {
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeImages":
+			if q.Get("Filter.1.Name") != "block-device-mapping.snapshot-id" {
+				t.Error("Expected snapshot filter, got", q)
+			}
+			image := ""
+			if q.Get("Filter.1.Value.1") == "snap-ami" {
+				image = `<item>
+            <imageId>ami-1a2b3c4d</imageId>
+            <blockDeviceMapping>
+                <item><deviceName>/dev/sda1</deviceName><ebs><snapshotId>snap-ami</snapshotId></ebs></item>
+            </blockDeviceMapping>
+        </item>`
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeImagesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <imagesSet>%s</imagesSet>
+</DescribeImagesResponse>`, image)
+		case "DeleteSnapshot":
+			deleted = append(deleted, q.Get("SnapshotId"))
+			fmt.Fprint(w, `<DeleteSnapshotResponse><return>true</return></DeleteSnapshotResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	err := DeleteSnapshotSafe(sr, "snap-ami")
+	if !errors.Is(err, ErrSnapshotInUse) {
+		t.Error("Expected ErrSnapshotInUse, got", err)
+	}
+	if e, ok := err.(*SnapshotInUseError); !ok || !reflect.DeepEqual(e.ImageIds, []string{"ami-1a2b3c4d"}) {
+		t.Error("Expected the image using the snapshot to be listed, got", err)
+	}
+	if err := DeleteSnapshotSafe(sr, "snap-1db38de7"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"snap-1db38de7"}) {
+		t.Error("Expected only the unused snapshot to be deleted, got", deleted)
+	}
+}
+
+func TestOrphanedSnapshots(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeSnapshots":
+			if q.Get("Owner.1") != "self" {
+				t.Error("Expected only our snapshots to be described, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>
+        <item><snapshotId>snap-live</snapshotId><volumeId>vol-live</volumeId><status>completed</status></item>
+        <item><snapshotId>snap-gone</snapshotId><volumeId>vol-gone</volumeId><status>completed</status></item>
+        <item><snapshotId>snap-gone2</snapshotId><volumeId>vol-gone</volumeId><status>completed</status></item>
+        <item><snapshotId>snap-copy</snapshotId><volumeId>vol-ffffffff</volumeId><status>completed</status></item>
+        <item><snapshotId>snap-ami</snapshotId><volumeId>vol-gone</volumeId><status>completed</status></item>
+    </snapshotSet>
+</DescribeSnapshotsResponse>`)
+		case "DescribeVolumes":
+			if q.Get("Filter.1.Name") != "volume-id" || q.Get("Filter.1.Value.1") != "vol-live" ||
+				q.Get("Filter.1.Value.2") != "vol-gone" || q.Get("Filter.1.Value.3") != "" {
+				t.Error("Expected the distinct source volumes to be looked up, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item><volumeId>vol-live</volumeId></item>
+    </volumeSet>
+</DescribeVolumesResponse>`)
+		case "DescribeImages":
+			if q.Get("Filter.1.Name") != "block-device-mapping.snapshot-id" || q.Get("Filter.1.Value.4") != "snap-ami" {
+				t.Error("Expected the candidates to be checked for images, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeImagesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <imagesSet>
+        <item>
+            <imageId>ami-1a2b3c4d</imageId>
+            <blockDeviceMapping>
+                <item><deviceName>/dev/sda1</deviceName><ebs><snapshotId>snap-ami</snapshotId></ebs></item>
+            </blockDeviceMapping>
+        </item>
+    </imagesSet>
+</DescribeImagesResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	snaps, err := OrphanedSnapshots(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, snap := range snaps {
+		ids = append(ids, snap.Id)
+	}
+	if e := []string{"snap-gone", "snap-gone2", "snap-copy"}; !reflect.DeepEqual(ids, e) {
+		t.Errorf("Expected %v to be orphaned, got %v", e, ids)
+	}
+}
+
+func TestImagesBySnapshotChunks(t *testing.T) {
+	snapshots := make([]string, maxFilterValues+1)
+	for i := range snapshots {
+		snapshots[i] = fmt.Sprintf("snap-%d", i)
+	}
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The image references a snapshot of each chunk and is found by both requests.
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeImagesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <imagesSet>
+        <item>
+            <imageId>ami-1a2b3c4d</imageId>
+            <blockDeviceMapping>
+                <item><deviceName>/dev/sda1</deviceName><ebs><snapshotId>snap-0</snapshotId></ebs></item>
+                <item><deviceName>/dev/sdf</deviceName><ebs><snapshotId>snap-%d</snapshotId></ebs></item>
+            </blockDeviceMapping>
+        </item>
+    </imagesSet>
+</DescribeImagesResponse>`, maxFilterValues)
+	}))
+	defer ts.Close()
+
+	refs, err := imagesBySnapshot(NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner), snapshots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := map[string][]string{"snap-0": {"ami-1a2b3c4d"}, fmt.Sprintf("snap-%d", maxFilterValues): {"ami-1a2b3c4d"}}
+	if requests != 2 || !reflect.DeepEqual(refs, e) {
+		t.Errorf("Expected %v from 2 requests, got %v from %d", e, refs, requests)
+	}
+}
@@ -0,0 +1,135 @@
+package aws
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryConfig controls how requests failing because of throttling, server errors or a skewed clock are retried.
+type RetryConfig struct {
+	// Attempts is the maximum number of times a request is sent, retrying is disabled when less than two.
+	Attempts int
+	// BaseDelay is waited before the first retry and doubled for every following one up to MaxDelay.
+	BaseDelay time.Duration
+	// MaxDelay also caps how long a Retry-After header can make us wait.
+	MaxDelay time.Duration
+	// Budget limits retries while Amazon keeps failing, each retry costs retryCost tokens of the budget and
+	// every successful request earns one back. Zero means retries are only limited by Attempts.
+	Budget int
+}
+
+// retryCost is the number of tokens of the retry budget spent by every retry.
+const retryCost = 5
+
+// DefaultRetryConfig is a reasonable configuration for WithRetry.
+var DefaultRetryConfig = RetryConfig{
+	Attempts:  5,
+	BaseDelay: 100 * time.Millisecond,
+	MaxDelay:  20 * time.Second,
+	Budget:    500,
+}
+
+// WithRetry enables retrying of failed requests. Requests rejected because of clock skew are signed again
+// once, corrected by the time Amazon reported if the signer is a TimeSigner.
+func WithRetry(config RetryConfig) Option {
+	return func(c *awsClient) {
+		c.retry = config
+	}
+}
+
+// retryBudget is a token bucket shared by all requests of a requester, which prevents retry storms when most
+// requests fail since they then spend more tokens than they earn.
+type retryBudget struct {
+	mu       sync.Mutex
+	tokens   int
+	capacity int
+}
+
+func newRetryBudget(capacity int) *retryBudget {
+	return &retryBudget{tokens: capacity, capacity: capacity}
+}
+
+// spend takes the cost of a retry from the budget, reporting false if there isn't enough left.
+func (b *retryBudget) spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < retryCost {
+		return false
+	}
+	b.tokens -= retryCost
+	return true
+}
+
+// earn refills the budget after a successful request.
+func (b *retryBudget) earn() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < b.capacity {
+		b.tokens++
+	}
+}
+
+// isThrottlingCode reports whether the error code means we are sending requests too fast.
+func isThrottlingCode(code string) bool {
+	switch code {
+	case "RequestLimitExceeded", "Throttling", "ThrottlingException", "ServiceUnavailable":
+		return true
+	}
+	return false
+}
+
+// IsThrottlingError reports whether Amazon refused the request because we are sending requests too fast, e.g.
+// for callers backing off themselves instead of relying on RetryConfig.
+func IsThrottlingError(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && (isThrottlingCode(apiErr.Code) || apiErr.StatusCode == 429)
+}
+
+// backoff returns the delay before the retry following the specified attempt.
+func (r *RetryConfig) backoff(attempt int) time.Duration {
+	delay := r.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if r.MaxDelay > 0 && delay >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+	return delay
+}
+
+// shouldRetry decides if the request should be sent again after failing with err and how long to wait first.
+func (c *awsClient) shouldRetry(err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.retry.Attempts {
+		return 0, false
+	}
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		return 0, false
+	}
+
+	if isClockSkewCode(apiErr.Code) {
+		if attempt > 1 {
+			return 0, false
+		}
+		if !apiErr.ServerTime.IsZero() {
+			atomic.StoreInt64(&c.skew, int64(apiErr.ServerTime.Sub(c.clock.Now())))
+		}
+		return 0, true
+	}
+	if isThrottlingCode(apiErr.Code) || apiErr.StatusCode == 429 || apiErr.StatusCode >= 500 {
+		if c.budget != nil && !c.budget.spend() {
+			return 0, false
+		}
+		// Amazon knows better than our backoff when it will accept requests again, but not how long we are
+		// willing to wait.
+		if apiErr.RetryAfter > 0 {
+			if c.retry.MaxDelay > 0 && apiErr.RetryAfter > c.retry.MaxDelay {
+				return c.retry.MaxDelay, true
+			}
+			return apiErr.RetryAfter, true
+		}
+		return c.retry.backoff(attempt), true
+	}
+	return 0, false
+}
@@ -0,0 +1,185 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryClockSkew(t *testing.T) {
+	clock := newFakeClock()
+	serverTime := clock.now.Add(time.Hour)
+
+	var dates []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dates = append(dates, r.Header.Get("X-Amz-Date"))
+		if r.Header.Get("X-Amz-Date") != serverTime.Format(v4TimeFormat) {
+			w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>RequestExpired</Code><Message>Request has expired.</Message></Error></Errors><RequestID>0d8ef2d5-5f1c-4c2e-9d3a-EXAMPLE</RequestID></Response>`)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DeleteVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <return>true</return>
+</DeleteVolumeResponse>`)
+	}))
+	defer ts.Close()
+
+	signer := testV4Signer()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, signer, WithClock(clock))
+	err := DeleteVolume(sr, "vol-72d8f579")
+	if err == nil {
+		t.Fatal("Expected request to fail without retry")
+	}
+	if !strings.Contains(err.Error(), "check that the system clock is correct") {
+		t.Error("Expected hint about the system clock, got", err)
+	}
+
+	dates = nil
+	sr = NewSignedRequester(http.DefaultClient, ts.URL, signer, WithClock(clock), WithRetry(DefaultRetryConfig))
+	if err := DeleteVolume(sr, "vol-72d8f579"); err != nil {
+		t.Error(err)
+	}
+	if len(dates) != 2 {
+		t.Error("Expected request to be signed again once, got", dates)
+	}
+}
+
+func TestRetryThrottling(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>RequestLimitExceeded</Code><Message>Request limit exceeded.</Message></Error></Errors><RequestID>0d8ef2d5-5f1c-4c2e-9d3a-EXAMPLE</RequestID></Response>`)
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	config := RetryConfig{Attempts: 4, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(clock), WithRetry(config))
+
+	if err := DeleteVolume(sr, "vol-72d8f579"); ErrorCode(err) != "RequestLimitExceeded" {
+		t.Error("Expected throttling error after retries, got", err)
+	}
+	if calls != 4 {
+		t.Error("Expected 4 attempts, got", calls)
+	}
+	if e := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; fmt.Sprint(clock.sleeps) != fmt.Sprint(e) {
+		t.Error("Unexpected backoff", clock.sleeps)
+	}
+}
+
+func TestEndpointOverride(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<CreateSnapshotResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotId>snap-1db38de7</snapshotId>
+</CreateSnapshotResponse>`)
+	}))
+	defer ts.Close()
+
+	failures := 0
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a := r.URL.Query().Get("Action"); a != "DeleteVolume" {
+			t.Error("Expected only DeleteVolume to be overridden, got", a)
+		}
+		failures++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>Unavailable</Code><Message>The server is overloaded.</Message></Error></Errors><RequestID>0d8ef2d5-5f1c-4c2e-9d3a-EXAMPLE</RequestID></Response>`)
+	}))
+	defer failing.Close()
+
+	config := RetryConfig{Attempts: 2, BaseDelay: time.Second, MaxDelay: time.Second}
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()), WithRetry(config),
+		WithEndpointOverride("DeleteVolume", failing.URL))
+
+	if _, err := CreateSnapshot(sr, "vol-72d8f579", "test"); err != nil {
+		t.Error(err)
+	}
+	err := DeleteVolume(sr, "vol-72d8f579")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Error("Expected the injected failure, got", err)
+	}
+	if failures != 2 {
+		t.Error("Expected the failing action to be retried, got attempts", failures)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>Unavailable</Code><Message>The server is overloaded.</Message></Error></Errors><RequestID>0d8ef2d5-5f1c-4c2e-9d3a-EXAMPLE</RequestID></Response>`)
+	}))
+	defer ts.Close()
+
+	config := RetryConfig{Attempts: 3, BaseDelay: time.Second, Budget: 2 * retryCost}
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()), WithRetry(config))
+
+	if err := DeleteVolume(sr, "vol-72d8f579"); err == nil {
+		t.Error("Expected request to fail")
+	}
+	if calls != 3 {
+		t.Error("Expected the budget to allow two retries, got attempts", calls)
+	}
+
+	calls = 0
+	if err := DeleteVolume(sr, "vol-72d8f579"); err == nil {
+		t.Error("Expected request to fail")
+	}
+	if calls != 1 {
+		t.Error("Expected no retry once the budget is exhausted, got attempts", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	clock := newFakeClock()
+	headers := []string{"5", clock.now.Add(time.Minute).Format(http.TimeFormat)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(headers) > 0 {
+			w.Header().Set("Retry-After", headers[0])
+			headers = headers[1:]
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>RequestLimitExceeded</Code><Message>Request limit exceeded.</Message></Error></Errors></Response>`)
+			return
+		}
+		fmt.Fprint(w, `<DeleteVolumeResponse><return>true</return></DeleteVolumeResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(clock), WithRetry(DefaultRetryConfig))
+	if err := DeleteVolume(sr, "vol-72d8f579"); err != nil {
+		t.Fatal(err)
+	}
+	// The HTTP date was a minute ahead when the clock had advanced by 5 seconds, longer than MaxDelay.
+	if e := []time.Duration{5 * time.Second, DefaultRetryConfig.MaxDelay}; fmt.Sprint(clock.sleeps) != fmt.Sprint(e) {
+		t.Errorf("Expected to wait as long as Retry-After asked up to MaxDelay, %v, got %v", e, clock.sleeps)
+	}
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	for _, code := range []string{"RequestLimitExceeded", "Throttling", "ThrottlingException", "ServiceUnavailable"} {
+		if !IsThrottlingError(&APIError{StatusCode: 503, Code: code}) {
+			t.Errorf("Expected %s to be a throttling error", code)
+		}
+	}
+	if !IsThrottlingError(&APIError{StatusCode: 429}) {
+		t.Error("Expected status 429 to be a throttling error")
+	}
+	for _, err := range []error{&APIError{StatusCode: 400, Code: "InvalidVolume.NotFound"}, ErrNotFound, nil} {
+		if IsThrottlingError(err) {
+			t.Error("Expected no throttling error, got", err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testV4Signer(opts ...SignerOption) *V4Signer {
+	s := NewV4Signer(Credentials{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, opts...)
+	s.Clock = &fakeClock{now: time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)}
+	return s
+}
+
+func TestV4SignerVanilla(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	testV4Signer(WithSigningService("service")).Sign(req)
+
+	e := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if a := req.Header.Get("Authorization"); a != e {
+		t.Error("Unexpected Authorization header", a)
+	}
+	if d := req.Header.Get("X-Amz-Date"); d != "20150830T123600Z" {
+		t.Error("Unexpected X-Amz-Date header", d)
+	}
+}
+
+func TestV4SignerExplicitRegion(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://vpce-0123456789abcdef-abcdefgh.ec2.eu-west-1.vpce.amazonaws.com/?Action=DescribeVolumes", nil)
+	testV4Signer(WithSigningRegion("eu-west-1")).Sign(req)
+
+	if a := req.Header.Get("Authorization"); !strings.Contains(a, "/20150830/eu-west-1/ec2/aws4_request") {
+		t.Error("Expected request to be signed for ec2 in eu-west-1, got", a)
+	}
+}
+
+func TestNoopSigner(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://ec2.eu-west-1.amazonaws.com/?Action=DescribeVolumes", nil)
+	before := req.URL.String()
+	NoopSigner.Sign(req)
+
+	if len(req.Header) != 0 {
+		t.Error("Expected no headers to be added, got", req.Header)
+	}
+	if req.URL.String() != before {
+		t.Error("Expected URL to be unmodified, got", req.URL)
+	}
+}
+
+func TestPresignURL(t *testing.T) {
+	signer := testV4Signer(WithSigningRegion("eu-west-1"))
+	sr := NewSignedRequester(nil, "https://ec2.eu-west-1.amazonaws.com", signer)
+
+	v := url.Values{"Action": []string{"DescribeVolumes"}}
+	presigned, err := PresignURL(sr, v, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(presigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("X-Amz-Expires") != "300" || q.Get("X-Amz-Credential") != "AKIDEXAMPLE/20150830/eu-west-1/ec2/aws4_request" {
+		t.Error("Unexpected presigned query", q)
+	}
+	if q.Get("X-Amz-Signature") == "" || q.Get("Version") != "2014-05-01" {
+		t.Error("Expected signature and version, got", q)
+	}
+
+	if _, err := PresignURL(NewSignedRequester(nil, "", NoopSigner), v, time.Minute); err == nil {
+		t.Error("Expected error when the signer can't presign")
+	}
+}
+
+func TestV4SignerSessionToken(t *testing.T) {
+	token := "AQoDYXdzEPT//////////wEXAMPLEtc764bNrC9SAPBSM22wDOk4x4HIZ8j4FZTwdQW"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Security-Token") != token {
+			t.Error("Expected security token header, got", r.Header)
+		}
+		if a := r.Header.Get("Authorization"); !strings.Contains(a, "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+			t.Error("Expected security token to be signed, got", a)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DeleteVolumeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</DeleteVolumeResponse>`)
+	}))
+	defer ts.Close()
+
+	signer := testV4Signer()
+	signer.Credentials.SecurityToken = token
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, signer)
+
+	if err := DeleteVolume(sr, "vol-72d8f579"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestV4SignerKeyCache(t *testing.T) {
+	signer := testV4Signer(WithSigningService("service"), WithSigningKeyCache())
+	clock := signer.Clock.(*fakeClock)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+		signer.Sign(req)
+		if a := req.Header.Get("Authorization"); !strings.HasSuffix(a, "Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31") {
+			t.Error("Expected the same signature as without cache, got", a)
+		}
+	}
+
+	clock.now = clock.now.Add(24 * time.Hour)
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	signer.Sign(req)
+	uncached, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	other := testV4Signer(WithSigningService("service"))
+	other.Clock = clock
+	other.Sign(uncached)
+	if a, e := req.Header.Get("Authorization"), uncached.Header.Get("Authorization"); a != e {
+		t.Errorf("Expected the key to be derived again the next day, got %s, expected %s", a, e)
+	}
+	if len(signer.keys.keys) != 1 {
+		t.Error("Expected the key of the previous day to be dropped, got", signer.keys.keys)
+	}
+}
+
+func benchmarkV4Signer(b *testing.B, opts ...SignerOption) {
+	signer := testV4Signer(opts...)
+	req, _ := http.NewRequest("GET", "https://ec2.eu-west-1.amazonaws.com/?Action=DescribeVolumes&Version=2014-05-01", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		signer.Sign(req)
+	}
+}
+
+func BenchmarkV4Signer(b *testing.B) {
+	benchmarkV4Signer(b)
+}
+
+func BenchmarkV4SignerKeyCache(b *testing.B) {
+	benchmarkV4Signer(b, WithSigningKeyCache())
+}
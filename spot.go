@@ -0,0 +1,107 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+)
+
+// SpotSpec describes the instances to launch with a spot request.
+type SpotSpec struct {
+	// SpotPrice is the maximum hourly price in USD, e.g. "0.05".
+	SpotPrice string
+	// InstanceCount defaults to one instance.
+	InstanceCount    int
+	ImageId          string
+	InstanceType     string
+	KeyName          string
+	SecurityGroupIds []string
+	SubnetId         string
+	AZ               string
+	// UserData in plain text, it is encoded before being sent.
+	UserData string
+}
+
+type SpotRequestState string
+
+// open | active | closed | cancelled | failed
+var (
+	SpotRequestOpen      SpotRequestState = "open"
+	SpotRequestActive    SpotRequestState = "active"
+	SpotRequestClosed    SpotRequestState = "closed"
+	SpotRequestCancelled SpotRequestState = "cancelled"
+	SpotRequestFailed    SpotRequestState = "failed"
+)
+
+func (s SpotRequestState) String() string {
+	return string(s)
+}
+
+type SpotInstanceRequest struct {
+	Id        string           `xml:"spotInstanceRequestId"`
+	SpotPrice string           `xml:"spotPrice"`
+	State     SpotRequestState `xml:"state"`
+	Status    struct {
+		Code    string `xml:"code"`
+		Message string `xml:"message"`
+	} `xml:"status"`
+	// InstanceId is set once the request has been fulfilled.
+	InstanceId string `xml:"instanceId"`
+}
+
+type spotInstanceRequestSet struct {
+	SpotInstanceRequestSet struct {
+		Items []SpotInstanceRequest `xml:"item"`
+	} `xml:"spotInstanceRequestSet"`
+}
+
+// RequestSpotInstances places a one-time spot request, returning the ids of the spot requests created.
+func RequestSpotInstances(sr SignedRequester, spec SpotSpec) ([]string, error) {
+	p := params{"SpotPrice": spec.SpotPrice, "Type": "one-time"}
+	if spec.InstanceCount > 0 {
+		p.Set("InstanceCount", strconv.Itoa(spec.InstanceCount))
+	}
+	p.Set("LaunchSpecification.ImageId", spec.ImageId)
+	p.Set("LaunchSpecification.InstanceType", spec.InstanceType)
+	if spec.KeyName != "" {
+		p.Set("LaunchSpecification.KeyName", spec.KeyName)
+	}
+	for n, group := range spec.SecurityGroupIds {
+		p.Set(fmt.Sprintf("LaunchSpecification.SecurityGroupId.%d", n+1), group)
+	}
+	if spec.SubnetId != "" {
+		p.Set("LaunchSpecification.SubnetId", spec.SubnetId)
+	}
+	if spec.AZ != "" {
+		p.Set("LaunchSpecification.Placement.AvailabilityZone", spec.AZ)
+	}
+	if spec.UserData != "" {
+		p.Set("LaunchSpecification.UserData", base64.StdEncoding.EncodeToString([]byte(spec.UserData)))
+	}
+
+	set := new(spotInstanceRequestSet)
+	if err := call(sr, "RequestSpotInstances", p, set); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(set.SpotInstanceRequestSet.Items))
+	for n, req := range set.SpotInstanceRequestSet.Items {
+		ids[n] = req.Id
+	}
+	return ids, nil
+}
+
+// SpotInstanceRequests returns the current state of the spot requests, including the id of the instance
+// launched for each fulfilled request.
+func SpotInstanceRequests(sr SignedRequester, ids ...string) ([]SpotInstanceRequest, error) {
+	p := make(params)
+	for n, id := range ids {
+		p.Set(fmt.Sprintf("SpotInstanceRequestId.%d", n+1), id)
+	}
+
+	set := new(spotInstanceRequestSet)
+	if err := call(sr, "DescribeSpotInstanceRequests", p, set); err != nil {
+		return nil, err
+	}
+	return set.SpotInstanceRequestSet.Items, nil
+}
@@ -0,0 +1,101 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSpotInstances(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "RequestSpotInstances":
+			if q.Get("SpotPrice") != "0.05" || q.Get("InstanceCount") != "2" || q.Get("LaunchSpecification.ImageId") != "ami-1a2b3c4d" ||
+				q.Get("LaunchSpecification.SecurityGroupId.1") != "sg-1a2b3c4d" || q.Get("LaunchSpecification.UserData") != "IyEvYmluL3NoCmVjaG8gaGVsbG8K" {
+				t.Error("Unexpected RequestSpotInstances params", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<RequestSpotInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <spotInstanceRequestSet>
+        <item>
+            <spotInstanceRequestId>sir-1a2b3c4d</spotInstanceRequestId>
+            <spotPrice>0.050000</spotPrice>
+            <state>open</state>
+            <status>
+                <code>pending-evaluation</code>
+                <message>Your Spot request has been submitted for review, and is pending evaluation.</message>
+            </status>
+        </item>
+        <item>
+            <spotInstanceRequestId>sir-5e6f7a8b</spotInstanceRequestId>
+            <spotPrice>0.050000</spotPrice>
+            <state>open</state>
+        </item>
+    </spotInstanceRequestSet>
+</RequestSpotInstancesResponse>`)
+		case "DescribeSpotInstanceRequests":
+			if q.Get("SpotInstanceRequestId.1") != "sir-1a2b3c4d" || q.Get("SpotInstanceRequestId.2") != "sir-5e6f7a8b" {
+				t.Error("Unexpected DescribeSpotInstanceRequests params", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSpotInstanceRequestsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+    <spotInstanceRequestSet>
+        <item>
+            <spotInstanceRequestId>sir-1a2b3c4d</spotInstanceRequestId>
+            <state>active</state>
+            <status>
+                <code>fulfilled</code>
+            </status>
+            <instanceId>i-7ae3b239</instanceId>
+        </item>
+        <item>
+            <spotInstanceRequestId>sir-5e6f7a8b</spotInstanceRequestId>
+            <state>open</state>
+            <status>
+                <code>capacity-not-available</code>
+            </status>
+        </item>
+    </spotInstanceRequestSet>
+</DescribeSpotInstanceRequestsResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	ids, err := RequestSpotInstances(sr, SpotSpec{
+		SpotPrice:        "0.05",
+		InstanceCount:    2,
+		ImageId:          "ami-1a2b3c4d",
+		InstanceType:     "m3.medium",
+		SecurityGroupIds: []string{"sg-1a2b3c4d"},
+		UserData:         "#!/bin/sh\necho hello\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := []string{"sir-1a2b3c4d", "sir-5e6f7a8b"}; !reflect.DeepEqual(ids, e) {
+		t.Error("Expected spot request ids", e, "got", ids)
+	}
+
+	reqs, err := SpotInstanceRequests(sr, ids...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 2 {
+		t.Fatal("Expected two spot requests, got", reqs)
+	}
+	if reqs[0].State != SpotRequestActive || reqs[0].Status.Code != "fulfilled" || reqs[0].InstanceId != "i-7ae3b239" {
+		t.Error("Expected first request to be fulfilled, got", reqs[0])
+	}
+	if reqs[1].State != SpotRequestOpen || reqs[1].InstanceId != "" {
+		t.Error("Expected second request to be open, got", reqs[1])
+	}
+}
@@ -0,0 +1,22 @@
+package aws
+
+// stsEndpoint is where roles of profiles are assumed.
+var stsEndpoint = "https://sts.amazonaws.com"
+
+const stsAPIVersion = "2011-06-15"
+
+// CallerIdentity returns the account, ARN and user id of the credentials the requester signs with, a cheap way
+// to verify them before doing anything else. The requester has to send its requests to STS and sign them for
+// the sts service, e.g. NewSignedRequester(nil, "https://sts.amazonaws.com", NewV4Signer(creds,
+// WithSigningService("sts"))).
+func CallerIdentity(sr SignedRequester) (account, arn, userId string, err error) {
+	res := &struct {
+		Account string `xml:"GetCallerIdentityResult>Account"`
+		Arn     string `xml:"GetCallerIdentityResult>Arn"`
+		UserId  string `xml:"GetCallerIdentityResult>UserId"`
+	}{}
+	if err = call(sr, "GetCallerIdentity", params{"Version": stsAPIVersion}, res); err != nil {
+		return "", "", "", err
+	}
+	return res.Account, res.Arn, res.UserId, nil
+}
@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCallerIdentity(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "GetCallerIdentity" || q.Get("Version") != stsAPIVersion {
+			t.Error("Unexpected request", q)
+		}
+		if a := r.Header.Get("Authorization"); !strings.Contains(a, "/us-east-1/sts/aws4_request") {
+			t.Error("Expected request to be signed for sts, got", a)
+		}
+		fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/Alice</Arn>
+    <UserId>AIDACKCEVSQ6C2EXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata>
+    <RequestId>01234567-89ab-cdef-0123-456789abcdef</RequestId>
+  </ResponseMetadata>
+</GetCallerIdentityResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, testV4Signer(WithSigningService("sts")))
+
+	account, arn, userId, err := CallerIdentity(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account != "123456789012" || arn != "arn:aws:iam::123456789012:user/Alice" || userId != "AIDACKCEVSQ6C2EXAMPLE" {
+		t.Error("Unexpected identity", account, arn, userId)
+	}
+}
+
+func TestWithVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.URL.Query().Get("Version"); v != stsAPIVersion {
+			t.Error("Expected the version of the requester, got", v)
+		}
+		fmt.Fprint(w, `<GetSessionTokenResponse></GetSessionTokenResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, NoopSigner, WithVersion(stsAPIVersion))
+	if err := call(sr, "GetSessionToken", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type ResourceTag struct {
+	ResourceId   string `xml:"resourceId"`
+	ResourceType string `xml:"resourceType"`
+	Key          string `xml:"key"`
+	Value        string `xml:"value"`
+}
+
+// DescribeTags returns the tags of all resources matching the filters, e.g. {"key", []string{"Stack"}}.
+func DescribeTags(sr SignedRequester, filters []Filter, opts ...ListOption) ([]ResourceTag, error) {
+	values := make(url.Values)
+	values.Add("Action", "DescribeTags")
+	addFilters(values, filters)
+	list := newListConfig(values, 1000, opts)
+
+	var tags []ResourceTag
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set := &struct {
+			TagSet struct {
+				Items []ResourceTag `xml:"item"`
+			} `xml:"tagSet"`
+			NextToken string `xml:"nextToken"`
+		}{}
+		if err := decode(sr, b, set); err != nil {
+			return "", err
+		}
+		tags = append(tags, set.TagSet.Items...)
+		return list.next(len(tags), set.NextToken), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags[:list.truncate(len(tags))], nil
+}
+
+// addTagSpecification tags the resource as part of the request creating it, requires latestAPIVersion.
+func addTagSpecification(values paramSetter, resourceType string, tags []TagItem) {
+	if len(tags) == 0 {
+		return
+	}
+	values.Set("TagSpecification.1.ResourceType", resourceType)
+	for n, tag := range tags {
+		values.Set(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", n+1), tag.Key)
+		values.Set(fmt.Sprintf("TagSpecification.1.Tag.%d.Value", n+1), tag.Value)
+	}
+}
+
+// EnsureTags tags the resource like TagResource when overwrite is set. Otherwise only the keys the resource
+// doesn't have yet are added, keeping the values of existing tags, e.g. ones changed by hand.
+func EnsureTags(sr SignedRequester, resourceId string, tags []TagItem, overwrite bool) error {
+	if !overwrite {
+		existing, err := DescribeTags(sr, []Filter{{"resource-id", []string{resourceId}}})
+		if err != nil {
+			return err
+		}
+		present := make(map[string]bool, len(existing))
+		for _, tag := range existing {
+			present[tag.Key] = true
+		}
+
+		var missing []TagItem
+		for _, tag := range tags {
+			if !present[tag.Key] {
+				missing = append(missing, tag)
+			}
+		}
+		tags = missing
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return TagResource(sr, resourceId, tags)
+}
+
+// CopyTags applies the tags of the source resource to the destination, e.g. from a volume to its snapshot.
+// Tags reserved by AWS, prefixed with aws:, can't be set and are skipped.
+func CopyTags(sr SignedRequester, sourceId, destId string) error {
+	existing, err := DescribeTags(sr, []Filter{{"resource-id", []string{sourceId}}})
+	if err != nil {
+		return err
+	}
+	tags := make([]TagItem, len(existing))
+	for n, tag := range existing {
+		tags[n] = TagItem{tag.Key, tag.Value}
+	}
+	if tags = copyableTags(tags); len(tags) == 0 {
+		return nil
+	}
+	return TagResource(sr, destId, tags)
+}
+
+// copyableTags returns the tags without those reserved by AWS.
+func copyableTags(tags []TagItem) []TagItem {
+	var copyable []TagItem
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag.Key, "aws:") {
+			copyable = append(copyable, tag)
+		}
+	}
+	return copyable
+}
+
+// mergeTags returns the tags with those of overrides added, replacing tags with the same key.
+func mergeTags(tags, overrides []TagItem) []TagItem {
+	var merged []TagItem
+	for _, tag := range tags {
+		replaced := false
+		for _, override := range overrides {
+			replaced = replaced || override.Key == tag.Key
+		}
+		if !replaced {
+			merged = append(merged, tag)
+		}
+	}
+	return append(merged, overrides...)
+}
@@ -0,0 +1,164 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDescribeTags(t *testing.T) {
+	pages := map[string]string{
+		"": `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeTagsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>7a62c49f-347e-4fc4-9331-6e8eEXAMPLE</requestId>
+    <tagSet>
+        <item>
+            <resourceId>vol-72d8f579</resourceId>
+            <resourceType>volume</resourceType>
+            <key>Stack</key>
+            <value>joonix-cluster</value>
+        </item>
+    </tagSet>
+    <nextToken>page2</nextToken>
+</DescribeTagsResponse>`,
+		"page2": `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeTagsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>7a62c49f-347e-4fc4-9331-6e8eEXAMPLE</requestId>
+    <tagSet>
+        <item>
+            <resourceId>i-7ae3b239</resourceId>
+            <resourceType>instance</resourceType>
+            <key>Stack</key>
+            <value>joonix-cluster</value>
+        </item>
+    </tagSet>
+</DescribeTagsResponse>`}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if a := "DescribeTags"; q.Get("Action") != a {
+			t.Errorf("Expected Action to be %s", a)
+		}
+		if q.Get("Filter.1.Name") != "key" || q.Get("Filter.1.Value.1") != "Stack" {
+			t.Error("Expected key filter, got", q)
+		}
+		if n := len(q["Version"]); n != 1 {
+			t.Error("Expected exactly one Version param, got", n)
+		}
+		fmt.Fprint(w, pages[q.Get("NextToken")])
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	tags, err := DescribeTags(sr, []Filter{{"key", []string{"Stack"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 {
+		t.Fatal("Expected tags from both pages, got", tags)
+	}
+	if tags[0].ResourceId != "vol-72d8f579" || tags[0].ResourceType != "volume" {
+		t.Error("Unexpected first tag", tags[0])
+	}
+	if tags[1].ResourceId != "i-7ae3b239" || tags[1].Value != "joonix-cluster" {
+		t.Error("Unexpected second tag", tags[1])
+	}
+}
+
+func TestEnsureTags(t *testing.T) {
+	var created []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeTags":
+			if q.Get("Filter.1.Name") != "resource-id" || q.Get("Filter.1.Value.1") != "vol-72d8f579" {
+				t.Error("Expected resource-id filter, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeTagsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <tagSet>
+        <item>
+            <resourceId>vol-72d8f579</resourceId>
+            <resourceType>volume</resourceType>
+            <key>Owner</key>
+            <value>ops</value>
+        </item>
+    </tagSet>
+</DescribeTagsResponse>`)
+		case "CreateTags":
+			for n := 1; q.Get(fmt.Sprintf("Tag.%d.Key", n)) != ""; n++ {
+				created = append(created, q.Get(fmt.Sprintf("Tag.%d.Key", n))+"="+q.Get(fmt.Sprintf("Tag.%d.Value", n)))
+			}
+			fmt.Fprint(w, `<CreateTagsResponse><return>true</return></CreateTagsResponse>`)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	tags := []TagItem{{"Owner", "cluster"}, {"Stack", "joonix-cluster"}}
+
+	if err := EnsureTags(sr, "vol-72d8f579", tags, false); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(created) != "[Stack=joonix-cluster]" {
+		t.Error("Expected only the missing tag to be added, got", created)
+	}
+
+	created = nil
+	if err := EnsureTags(sr, "vol-72d8f579", tags, true); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(created) != "[Owner=cluster Stack=joonix-cluster]" {
+		t.Error("Expected every tag to be overwritten, got", created)
+	}
+
+	created = nil
+	if err := EnsureTags(sr, "vol-72d8f579", tags[:1], false); err != nil || created != nil {
+		t.Error("Expected nothing to be tagged when no tag is missing, got", created, err)
+	}
+}
+
+func TestCopyTags(t *testing.T) {
+	var copied url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch action := q.Get("Action"); action {
+		case "DescribeTags":
+			if q.Get("Filter.1.Name") != "resource-id" || q.Get("Filter.1.Value.1") != "vol-72d8f579" {
+				t.Error("Expected a resource-id filter, got", q)
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeTagsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <tagSet>
+        <item><resourceId>vol-72d8f579</resourceId><resourceType>volume</resourceType><key>Name</key><value>data</value></item>
+        <item><resourceId>vol-72d8f579</resourceId><resourceType>volume</resourceType><key>aws:cloudformation:stack-name</key><value>db</value></item>
+        <item><resourceId>vol-72d8f579</resourceId><resourceType>volume</resourceType><key>Stack</key><value>prod</value></item>
+    </tagSet>
+</DescribeTagsResponse>`)
+		case "CreateTags":
+			copied = q
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := CopyTags(sr, "vol-72d8f579", "snap-1db38de7"); err != nil {
+		t.Fatal(err)
+	}
+	if copied.Get("ResourceId.1") != "snap-1db38de7" || copied.Get("Tag.1.Key") != "Name" || copied.Get("Tag.2.Key") != "Stack" || copied.Get("Tag.3.Key") != "" {
+		t.Error("Expected the tags but the reserved one to be copied, got", copied)
+	}
+
+	merged := mergeTags([]TagItem{{"Name", "data"}, {"Stack", "prod"}}, []TagItem{{"Name", "data-b"}})
+	if fmt.Sprint(merged) != "[{Stack prod} {Name data-b}]" {
+		t.Error("Expected the specified tags to replace the copied ones, got", merged)
+	}
+}
@@ -0,0 +1,123 @@
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// VolumeStatusInfo describes the health of a volume, e.g. whether I/O is enabled after an incident.
+type VolumeStatusInfo struct {
+	VolumeId string `xml:"volumeId"`
+	AZ       string `xml:"availabilityZone"`
+	Status   struct {
+		// Status is one of ok, impaired, warning and insufficient-data.
+		Status string `xml:"status"`
+		// Details are the checks of io-enabled and io-performance with their status, e.g. passed or failed.
+		Details []VolumeStatusDetail `xml:"details>item"`
+	} `xml:"volumeStatus"`
+	Events  []VolumeStatusEvent  `xml:"eventsSet>item"`
+	Actions []VolumeStatusAction `xml:"actionsSet>item"`
+}
+
+type VolumeStatusDetail struct {
+	Name   string `xml:"name"`
+	Status string `xml:"status"`
+}
+
+// VolumeStatusEvent is an incident affecting the volume, e.g. potential-data-inconsistency.
+type VolumeStatusEvent struct {
+	Id          string    `xml:"eventId"`
+	Type        string    `xml:"eventType"`
+	Description string    `xml:"description"`
+	NotBefore   Timestamp `xml:"notBefore"`
+	NotAfter    Timestamp `xml:"notAfter"`
+}
+
+// VolumeStatusAction is an action to take because of an event, e.g. enable-volume-io when I/O was disabled
+// and autoEnableIO is not set.
+type VolumeStatusAction struct {
+	Code        string `xml:"code"`
+	EventId     string `xml:"eventId"`
+	EventType   string `xml:"eventType"`
+	Description string `xml:"description"`
+}
+
+// Detail returns the status of the named check, e.g. io-enabled, or an empty string if it wasn't reported.
+func (s *VolumeStatusInfo) Detail(name string) string {
+	for _, d := range s.Status.Details {
+		if d.Name == name {
+			return d.Status
+		}
+	}
+	return ""
+}
+
+// IOEnabled reports whether I/O is enabled for the volume, it is disabled after potential data inconsistency
+// unless autoEnableIO is set.
+func (s *VolumeStatusInfo) IOEnabled() bool {
+	return s.Detail("io-enabled") == "passed"
+}
+
+// DescribeVolumeStatus returns the status of the volumes among ids matching the filters, or of every volume
+// matching the filters without ids.
+func DescribeVolumeStatus(sr SignedRequester, ids []string, filters []Filter, opts ...ListOption) ([]VolumeStatusInfo, error) {
+	values := make(url.Values)
+	values.Add("Action", "DescribeVolumeStatus")
+	for i, id := range ids {
+		values.Add(fmt.Sprintf("VolumeId.%d", i+1), id)
+	}
+	addFilters(values, filters)
+	maxResults := 1000
+	if len(ids) > 0 {
+		maxResults = 0
+	}
+	list := newListConfig(values, maxResults, opts)
+
+	var statuses []VolumeStatusInfo
+	err := paginate(sr, values, func(b []byte) (string, error) {
+		set := &struct {
+			Items     []VolumeStatusInfo `xml:"volumeStatusSet>item"`
+			NextToken string             `xml:"nextToken"`
+		}{}
+		if err := decode(sr, b, set); err != nil {
+			return "", err
+		}
+		statuses = append(statuses, set.Items...)
+		return list.next(len(statuses), set.NextToken), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses[:list.truncate(len(statuses))], nil
+}
+
+// AutoEnableIO reports whether I/O is enabled again automatically after the volume was impaired.
+func AutoEnableIO(sr SignedRequester, volumeId string) (bool, error) {
+	attr := &struct {
+		Value bool `xml:"autoEnableIO>value"`
+	}{}
+	if err := call(sr, "DescribeVolumeAttribute", params{"VolumeId": volumeId, "Attribute": "autoEnableIO"}, attr); err != nil {
+		return false, err
+	}
+	return attr.Value, nil
+}
+
+// SetAutoEnableIO changes whether I/O is enabled again automatically after the volume was impaired, reading
+// the attribute back to confirm the change.
+func SetAutoEnableIO(sr SignedRequester, volumeId string, enabled bool) error {
+	p := params{"VolumeId": volumeId, "AutoEnableIO.Value": strconv.FormatBool(enabled)}
+	if err := call(sr, "ModifyVolumeAttribute", p, nil); err != nil {
+		return err
+	}
+
+	actual, err := AutoEnableIO(sr, volumeId)
+	if err != nil {
+		return err
+	}
+	if actual != enabled {
+		return fmt.Errorf("AutoEnableIO of %s is still %t", volumeId, actual)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDescribeVolumeStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeVolumeStatus" || q.Get("VolumeId.1") != "vol-1234abcd" || q.Get("MaxResults") != "" {
+			t.Error("Unexpected request", q)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumeStatusResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <requestId>5jkdf074-37ed-4004-8671-a78ee82bf1cbEXAMPLE</requestId>
+    <volumeStatusSet>
+        <item>
+            <volumeId>vol-1234abcd</volumeId>
+            <availabilityZone>us-east-1d</availabilityZone>
+            <volumeStatus>
+                <status>impaired</status>
+                <details>
+                    <item>
+                        <name>io-enabled</name>
+                        <status>failed</status>
+                    </item>
+                    <item>
+                        <name>io-performance</name>
+                        <status>not-applicable</status>
+                    </item>
+                </details>
+            </volumeStatus>
+            <eventsSet>
+                <item>
+                    <eventId>evol-61a54008</eventId>
+                    <eventType>potential-data-inconsistency</eventType>
+                    <description>THIS IS AN EXAMPLE</description>
+                    <notBefore>2011-12-01T14:00:00.000Z</notBefore>
+                    <notAfter>2011-12-01T15:00:00.000Z</notAfter>
+                </item>
+            </eventsSet>
+            <actionsSet>
+                <item>
+                    <code>enable-volume-io</code>
+                    <eventId>evol-61a54008</eventId>
+                    <eventType>potential-data-inconsistency</eventType>
+                    <description>THIS IS AN EXAMPLE</description>
+                </item>
+            </actionsSet>
+        </item>
+    </volumeStatusSet>
+</DescribeVolumeStatusResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, StrictDecoding())
+
+	statuses, err := DescribeVolumeStatus(sr, []string{"vol-1234abcd"}, nil, Limit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatal("Expected one status, got", statuses)
+	}
+	s := statuses[0]
+	if s.VolumeId != "vol-1234abcd" || s.AZ != "us-east-1d" || s.Status.Status != "impaired" {
+		t.Error("Unexpected status", s)
+	}
+	if s.IOEnabled() || s.Detail("io-performance") != "not-applicable" {
+		t.Error("Expected I/O to be disabled, got", s.Status.Details)
+	}
+	if len(s.Events) != 1 || s.Events[0].Type != "potential-data-inconsistency" || s.Events[0].NotAfter.Hour() != 15 {
+		t.Error("Unexpected events", s.Events)
+	}
+	if len(s.Actions) != 1 || s.Actions[0].Code != "enable-volume-io" || s.Actions[0].EventId != s.Events[0].Id {
+		t.Error("Unexpected actions", s.Actions)
+	}
+}
+
+func TestSetAutoEnableIO(t *testing.T) {
+	value := "false"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("VolumeId") != "vol-1234abcd" {
+			t.Error("Unexpected volume", q)
+		}
+		switch action := q.Get("Action"); action {
+		case "ModifyVolumeAttribute":
+			value = q.Get("AutoEnableIO.Value")
+			fmt.Fprint(w, `<ModifyVolumeAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <return>true</return>
+</ModifyVolumeAttributeResponse>`)
+		case "DescribeVolumeAttribute":
+			if q.Get("Attribute") != "autoEnableIO" {
+				t.Error("Unexpected attribute", q)
+			}
+			fmt.Fprintf(w, `<DescribeVolumeAttributeResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeId>vol-1234abcd</volumeId>
+    <autoEnableIO>
+        <value>%s</value>
+    </autoEnableIO>
+</DescribeVolumeAttributeResponse>`, value)
+		default:
+			t.Errorf("Unexpected action '%s'", action)
+		}
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+
+	if err := SetAutoEnableIO(sr, "vol-1234abcd", true); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, err := AutoEnableIO(sr, "vol-1234abcd"); err != nil || !enabled {
+		t.Error("Expected autoEnableIO to be set, got", enabled, err)
+	}
+}
@@ -0,0 +1,168 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Clock abstracts the passing of time so that waiting can be tested without real sleeps.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// RealClock is the Clock backed by the time package, used unless another one is specified.
+var RealClock Clock = realClock{}
+
+// WaitOptions controls how the WaitFor* helpers poll the API. The poll interval starts at Interval
+// and is multiplied by Multiplier after every poll until it reaches MaxInterval, so quick operations
+// are noticed early while long running ones don't waste API quota.
+type WaitOptions struct {
+	Interval    time.Duration
+	MaxInterval time.Duration
+	Multiplier  float64
+	// Timeout gives up waiting after the specified duration, zero means wait until the context is done.
+	Timeout time.Duration
+	// Clock used for sleeping between polls, defaults to the clock of the requester.
+	Clock Clock
+}
+
+// DefaultWaitOptions is used when no options are passed to the WaitFor* helpers.
+var DefaultWaitOptions = WaitOptions{
+	Interval:    time.Second,
+	MaxInterval: 30 * time.Second,
+	Multiplier:  1.5,
+	Timeout:     10 * time.Minute,
+}
+
+// next returns the interval to use for the poll following one made after current.
+func (o *WaitOptions) next(current time.Duration) time.Duration {
+	if o.Multiplier <= 1 {
+		return current
+	}
+	next := time.Duration(float64(current) * o.Multiplier)
+	if o.MaxInterval > 0 && next > o.MaxInterval {
+		next = o.MaxInterval
+	}
+	return next
+}
+
+// clockOf returns the clock of the requester, or RealClock if it wasn't created by NewSignedRequester.
+func clockOf(sr SignedRequester) Clock {
+	if c, ok := sr.(*awsClient); ok && c.clock != nil {
+		return c.clock
+	}
+	return RealClock
+}
+
+// wait calls done according to the options until it reports true, returns an error or times out.
+// Unless the options specify a clock the one of the requester is used.
+func wait(ctx context.Context, sr SignedRequester, opts *WaitOptions, done func() (bool, error)) error {
+	if opts == nil {
+		opts = &DefaultWaitOptions
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = clockOf(sr)
+	}
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = clock.Now().Add(opts.Timeout)
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultWaitOptions.Interval
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(interval):
+		}
+
+		if ok, err := done(); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+		if !deadline.IsZero() && !clock.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+		interval = opts.next(interval)
+	}
+}
+
+// WaitForVolumeStatus polls the volume until it reaches the specified status, failing once it reaches another
+// terminal status. When waiting for VolumeDeleted a volume that is gone entirely counts as deleted.
+func WaitForVolumeStatus(ctx context.Context, sr SignedRequester, id string, status VolumeStatus, opts *WaitOptions) (*EbsVolume, error) {
+	var vol *EbsVolume
+	err := wait(ctx, sr, opts, func() (bool, error) {
+		var err error
+		if vol, err = VolumeByIdAllowDeleted(sr, id); err == ErrNotFound && status == VolumeDeleted {
+			vol = &EbsVolume{Id: id, Status: VolumeDeleted}
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		if vol.Status.IsTerminal() && vol.Status != status {
+			return false, fmt.Errorf("Volume %s entered the %s state", id, vol.Status)
+		}
+		return vol.Status == status, nil
+	})
+	return vol, err
+}
+
+// WaitForDetach polls the volume until it's no longer attached to any instance.
+func WaitForDetach(ctx context.Context, sr SignedRequester, id string, opts *WaitOptions) (*EbsVolume, error) {
+	var vol *EbsVolume
+	err := wait(ctx, sr, opts, func() (bool, error) {
+		var err error
+		if vol, err = VolumeById(sr, id); err != nil {
+			return false, err
+		}
+		return vol.Attachment() == nil && vol.Status != VolumeInUse, nil
+	})
+	return vol, err
+}
+
+// WaitForSnapshotStatus polls the snapshot until it reaches the specified status, failing once it reaches
+// another terminal status.
+func WaitForSnapshotStatus(ctx context.Context, sr SignedRequester, id string, status SnapshotStatus, opts *WaitOptions) (*EbsSnapshot, error) {
+	var snap *EbsSnapshot
+	err := wait(ctx, sr, opts, func() (bool, error) {
+		var err error
+		if snap, err = SnapshotById(sr, id); err != nil {
+			return false, err
+		}
+		if snap.Status.IsTerminal() && snap.Status != status {
+			return false, fmt.Errorf("Snapshot %s entered the %s state", id, snap.Status)
+		}
+		return snap.Status == status, nil
+	})
+	return snap, err
+}
+
+// WaitForInstanceState polls the instance until it reaches the specified state.
+func WaitForInstanceState(ctx context.Context, sr SignedRequester, id string, state InstanceState, opts *WaitOptions) (*Instance, error) {
+	var instance *Instance
+	err := wait(ctx, sr, opts, func() (bool, error) {
+		var err error
+		if instance, err = InstanceById(sr, id); err != nil {
+			return false, err
+		}
+		return instance.State.Name == state, nil
+	})
+	return instance, err
+}
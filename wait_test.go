@@ -0,0 +1,174 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitOptionsBackoff(t *testing.T) {
+	opts := WaitOptions{Interval: time.Second, MaxInterval: 5 * time.Second, Multiplier: 2}
+
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	interval := opts.Interval
+	for _, e := range expected {
+		interval = opts.next(interval)
+		if interval != e {
+			t.Errorf("Expected interval to be %s, got %s", e, interval)
+		}
+	}
+
+	fixed := WaitOptions{Interval: time.Second}
+	if interval := fixed.next(time.Second); interval != time.Second {
+		t.Error("Expected fixed interval without multiplier, got", interval)
+	}
+}
+
+// fakeClock advances instantly whenever it is asked to sleep, recording the requested durations. It may be
+// shared by the goroutines of the batch helpers.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2014, 10, 6, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestWaitForVolumeStatus(t *testing.T) {
+	statuses := []string{"creating", "creating", "available"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a := "DescribeVolumes"; r.URL.Query().Get("Action") != a {
+			t.Errorf("Expected Action to be %s", a)
+		}
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-842b078f</volumeId>
+            <status>%s</status>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, status)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner)
+	clock := newFakeClock()
+	opts := &WaitOptions{Interval: time.Second, Multiplier: 2, Timeout: time.Minute, Clock: clock}
+
+	vol, err := WaitForVolumeStatus(context.Background(), sr, "vol-842b078f", VolumeAvailable, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.Status != VolumeAvailable {
+		t.Error("Expected volume to be available, got", vol.Status)
+	}
+	if !reflect.DeepEqual(clock.sleeps, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}) {
+		t.Error("Unexpected poll intervals", clock.sleeps)
+	}
+
+	statuses = []string{"creating"}
+	clock = newFakeClock()
+	opts.Clock = clock
+	if _, err := WaitForVolumeStatus(context.Background(), sr, "vol-842b078f", VolumeAvailable, opts); err != context.DeadlineExceeded {
+		t.Error("Expected to time out, got", err)
+	}
+	if elapsed := clock.now.Sub(newFakeClock().now); elapsed < time.Minute {
+		t.Error("Expected to wait for the whole timeout, waited", elapsed)
+	}
+
+	statuses = []string{"creating", "error"}
+	opts.Clock = newFakeClock()
+	if _, err := WaitForVolumeStatus(context.Background(), sr, "vol-842b078f", VolumeAvailable, opts); err == nil || err.Error() != "Volume vol-842b078f entered the error state" {
+		t.Error("Expected to stop once the volume failed, got", err)
+	}
+}
+
+func TestWaitForSnapshotStatusTerminal(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <snapshotSet>
+        <item><snapshotId>snap-1a2b3c4d</snapshotId><status>completed</status></item>
+    </snapshotSet>
+</DescribeSnapshotsResponse>`)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+
+	if _, err := WaitForSnapshotStatus(context.Background(), sr, "snap-1a2b3c4d", SnapshotError, nil); err == nil || err.Error() != "Snapshot snap-1a2b3c4d entered the completed state" {
+		t.Error("Expected not to wait for a completed snapshot to fail, got", err)
+	}
+}
+
+func TestWaitForDetach(t *testing.T) {
+	attachments := []string{"attached", "detaching", ""}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, attachment := "in-use", attachments[0]
+		if len(attachments) > 1 {
+			attachments = attachments[1:]
+		}
+		if attachment == "" {
+			status = "available"
+		} else {
+			attachment = `<item><volumeId>vol-842b078f</volumeId><instanceId>i-7ae3b239</instanceId><device>/dev/sdf</device><status>` + attachment + `</status></item>`
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeVolumesResponse xmlns="http://ec2.amazonaws.com/doc/2014-05-01/">
+    <volumeSet>
+        <item>
+            <volumeId>vol-842b078f</volumeId>
+            <status>%s</status>
+            <attachmentSet>%s</attachmentSet>
+        </item>
+    </volumeSet>
+</DescribeVolumesResponse>`, status, attachment)
+	}))
+	defer ts.Close()
+
+	sr := NewSignedRequester(http.DefaultClient, ts.URL, DefaultSigner, WithClock(newFakeClock()))
+
+	vol, err := VolumeById(sr, "vol-842b078f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if att := vol.Attachment(); att == nil || att.InstanceId != "i-7ae3b239" || att.Device != "/dev/sdf" {
+		t.Error("Expected the attachment to i-7ae3b239, got", att)
+	}
+
+	vol, err = WaitForDetach(context.Background(), sr, "vol-842b078f", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.Status != VolumeAvailable || vol.Attachment() != nil {
+		t.Error("Expected the volume to be detached, got", vol)
+	}
+}